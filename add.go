@@ -1,35 +1,54 @@
 package main
 
 import (
-	"time"
-
 	"github.com/pkg/errors"
+	"github.com/scgolang/nsm"
 	"github.com/scgolang/osc"
 )
 
 // Add starts a new client program.
-func (app *App) Add(msg osc.Message) error {
-	currentSession := app.sessions.Current()
-	cmdname, err := currentSession.SpawnFrom(msg, app.Conn)
+// The client is added to the current session's manifest after it announces itself,
+// then it is told to open its project.
+// The reply to the add request is sent after the client has replied to the open message.
+func (app *App) Add(msg osc.Message) (string, nsm.Error) {
+	currentSession, err := app.sessions.Current()
 	if err != nil {
-		return errors.Wrap(err, "adding client from osc message")
-	}
-	if err := currentSession.CreateCmdDirectory(cmdname); err != nil {
-		return errors.Wrap(err, "creating directory for new client")
+		return "", nsm.NewError(nsm.ErrNoSessionOpen, err.Error())
 	}
-	if err := currentSession.PipeOutputFor(cmdname, app.errgrp); err != nil {
-		return errors.Wrap(err, "piping output from new client")
+	entry, pid, err := currentSession.SpawnFrom(msg, app.Conn, app)
+	if err != nil {
+		return "", nsm.NewError(nsm.ErrLaunchFailed, err.Error())
 	}
+	app.Debugf("launched client %s with pid %d", entry.ID, pid)
 
-	// Wait for announcement from the new client then respond to
-	// the client who issued the add request.
-	select {
-	case <-time.After(2 * time.Second):
-		return errors.New("timeout")
-	case announcement := <-app.Announcements:
-		m := "sending announcement response to client who requested the add operation"
-		return errors.Wrap(app.SendTo(msg.Sender, announcement), m)
+	// Wait for the new client to announce itself then tell it to open its project.
+	client, err := currentSession.WaitAnnounce(pid, app.LaunchTimeout)
+	if err != nil {
+		if status, err := currentSession.Kill(entry.ID); err == nil {
+			app.Debugf("killed client %s: %s", entry.ID, status)
+		}
+		return "", nsm.NewError(nsm.ErrLaunchFailed, err.Error())
+	}
+	// Use the name the client announced itself with,
+	// unless it can not be written to the manifest or used to name the client's directory,
+	// in which case the client keeps the name of its executable.
+	named := entry
+	named.Name = client.ApplicationName
+	if err := named.Validate(); err != nil {
+		app.Debugf("client %s announced an invalid name: %s", entry.ID, err)
+	} else {
+		entry = named
 	}
 
-	return nil
+	if err := currentSession.Record(entry); err != nil {
+		return "", nsm.NewError(nsm.ErrGeneral, err.Error())
+	}
+	result, err := app.sendOpen(currentSession, entry.ID, client)
+	if err != nil {
+		if nerr, ok := errors.Cause(err).(nsm.Error); ok {
+			return "", nsm.NewError(nerr.Code(), "opening client "+entry.ID+": "+nerr.Error())
+		}
+		return "", nsm.NewError(nsm.ErrGeneral, "opening client "+entry.ID+": "+err.Error())
+	}
+	return "added client " + entry.ID + ": " + result, nil
 }
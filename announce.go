@@ -1,18 +1,27 @@
 package main
 
 import (
-	"time"
+	"path/filepath"
 
+	"github.com/pkg/errors"
 	"github.com/scgolang/nsm"
 	"github.com/scgolang/osc"
 )
 
 // Announce handles the announcement of new clients.
+// Clients that were launched by the current session are matched by their pid
+// to whoever is waiting for them to announce themselves.
+// Clients that were started some other way are recorded in the current session's manifest
+// and told to open their project, since nobody is waiting for them to announce themselves.
 func (app *App) Announce(msg osc.Message) (string, nsm.Error) {
 	app.Debug("got announcement")
 
 	// Add to client map.
-	client, err := app.sessions.Current().Announce(msg)
+	currentSession, err := app.sessions.Current()
+	if err != nil {
+		return "", nsm.NewError(nsm.ErrNoSessionOpen, err.Error())
+	}
+	client, awaited, err := currentSession.Announce(msg)
 	if err != nil {
 		return "", nsm.NewError(nsm.ErrLaunchFailed, err.Error())
 	}
@@ -31,14 +40,37 @@ func (app *App) Announce(msg osc.Message) (string, nsm.Error) {
 	if err := app.SendTo(msg.Sender, response); err != nil {
 		return "", nsm.NewError(nsm.ErrGeneral, err.Error())
 	}
+	if awaited {
+		return "successful announcement from " + client.ApplicationName, nil
+	}
+	app.Debugf("client %s with pid %d was not launched by session %s", client.ID, client.Pid, currentSession.Name())
 
-	// Send the announcement response on a channel.
-	// This is how other clients who have requested the add operation
-	// will find out about how the announcement handshake went
-	select {
-	case <-time.After(5 * time.Second):
-		return "", nsm.NewError(nsm.ErrGeneral, "timeout sending announcement response on a channel")
-	case app.Announcements <- response:
+	result, err := app.addAnnounced(currentSession, client)
+	if err != nil {
+		if nerr, ok := errors.Cause(err).(nsm.Error); ok {
+			return "", nsm.NewError(nerr.Code(), "opening client "+client.ID+": "+nerr.Error())
+		}
+		return "", nsm.NewError(nsm.ErrGeneral, "opening client "+client.ID+": "+err.Error())
+	}
+	return "added client " + client.ID + ": " + result, nil
+}
+
+// addAnnounced records a client that announced itself without being launched by the session,
+// then tells it to open its project.
+func (app *App) addAnnounced(sesh *Session, client *Client) (string, error) {
+	entry := ManifestEntry{
+		Name:       client.ApplicationName,
+		Executable: client.ExecutableName,
+		ID:         client.ID,
+	}
+	// Clients with a name that can not be written to the manifest or used to name
+	// the client's directory are named after their executable, as in Add.
+	if err := entry.Validate(); err != nil {
+		app.Debugf("client %s announced an invalid name: %s", client.ID, err)
+		entry.Name = filepath.Base(client.ExecutableName)
+	}
+	if err := sesh.Record(entry); err != nil {
+		return "", errors.Wrap(err, "recording client")
 	}
-	return "successful announcement from " + client.ApplicationName, nil
+	return app.sendOpen(sesh, entry.ID, client)
 }
@@ -5,6 +5,8 @@ import (
 	"log"
 	"net"
 	"strconv"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/scgolang/nsm"
@@ -17,34 +19,54 @@ type App struct {
 	Config
 	osc.Conn
 
-	Announcements chan osc.Message
-	Errors        chan osc.Message
-	Replies       chan osc.Message
-
 	Capabilities nsm.Capabilities
 
+	cancel   context.CancelFunc
 	ctx      context.Context
 	errgrp   *errgroup.Group
 	sessions *Sessions
+	stopOnce sync.Once
+
+	// sessionMutex is held by the requests that change which session is current,
+	// or that start and stop the clients of the current session as a whole,
+	// since the osc server handles each request in its own goroutine.
+	sessionMutex sync.Mutex
+
+	// controllers maps the addresses of controllers to themselves.
+	controllers      map[string]net.Addr
+	controllersMutex sync.RWMutex
+
+	// replies maps client requests that are waiting for a reply
+	// to channels that receive the reply.
+	// Replies do not identify the request they reply to, so requests to the same client
+	// with the same address wait in a queue and each reply is delivered to the oldest one.
+	replies      map[string][]chan osc.Message
+	repliesMutex sync.Mutex
+
+	// restarts maps clients (by session path and client ID)
+	// to the times they were restarted after exiting.
+	restarts      map[string][]time.Time
+	restartsMutex sync.Mutex
 }
 
 // NewApp creates a new application.
 func NewApp(ctx context.Context, config Config) (*App, error) {
+	ctx, cancel := context.WithCancel(ctx)
 	g, gctx := errgroup.WithContext(ctx)
 
 	app := &App{
 		Config: config,
 
-		Announcements: make(chan osc.Message),
-		Errors:        make(chan osc.Message),
-		Replies:       make(chan osc.Message),
-
 		Capabilities: nsm.Capabilities{nsm.CapServerControl},
 
-		ctx:    gctx,
-		errgrp: g,
+		cancel:      cancel,
+		controllers: map[string]net.Addr{},
+		ctx:         gctx,
+		errgrp:      g,
+		replies:     map[string][]chan osc.Message{},
+		restarts:    map[string][]time.Time{},
 	}
-	sessions, err := NewSessions(gctx, app, config.Home)
+	sessions, err := NewSessions(gctx, app, app, config.Home, config.Templates)
 	if err != nil {
 		return nil, errors.Wrap(err, "opening sessions")
 	}
@@ -73,18 +95,56 @@ func (app *App) Debugf(format string, args ...interface{}) {
 // dispatcher returns the osc Dispatcher for the application.
 func (app *App) dispatcher() osc.Dispatcher {
 	return osc.Dispatcher{
-		nsm.AddressServerAdd:      app.Add,
-		nsm.AddressServerAnnounce: app.OscMethod(app.Announce, nsm.AddressServerAnnounce),
-		nsm.AddressClientLogs:     app.ClientLogs,
-		nsm.AddressServerClients:  app.ListClients,
-		nsm.AddressServerSessions: app.ListSessions,
-		nsm.AddressServerNew:      app.OscMethod(app.NewSession, nsm.AddressServerNew),
-		"/ping":                   app.Ping,
-		nsm.AddressServerRemove:   app.OscMethod(app.RemoveSession, nsm.AddressServerRemove),
-		nsm.AddressReply:          app.Reply,
+		AddressGUIAnnounce:           app.OscMethod(app.AnnounceController, AddressGUIAnnounce),
+		AddressClientHideGUI:         app.OscMethod(app.HideClientGUI, AddressClientHideGUI),
+		AddressClientShowGUI:         app.OscMethod(app.ShowClientGUI, AddressClientShowGUI),
+		AddressClientKill:            app.OscMethod(app.KillClient, AddressClientKill),
+		AddressClientResume:          app.OscMethod(app.ResumeClient, AddressClientResume),
+		AddressClientStop:            app.OscMethod(app.StopClient, AddressClientStop),
+		AddressClientRemove:          app.OscMethod(app.RemoveClient, AddressClientRemove),
+		AddressSessionSnapshot:       app.OscMethod(app.SnapshotSession, AddressSessionSnapshot),
+		AddressSessionListSnapshots:  app.ListSnapshots,
+		AddressSessionRestore:        app.OscMethod(app.RestoreSnapshot, AddressSessionRestore),
+		AddressSessionDeleteSnapshot: app.OscMethod(app.DeleteSnapshot, AddressSessionDeleteSnapshot),
+		AddressSessionHistory:        app.ListHistory,
+		AddressSessionDiff:           app.DiffHistory,
+		AddressSessionCheckout:       app.OscMethod(app.CheckoutHistory, AddressSessionCheckout),
+		AddressSessionExport:         app.OscMethod(app.ExportSession, AddressSessionExport),
+		AddressSessionImport:         app.OscMethod(app.ImportSession, AddressSessionImport),
+		AddressSessionList:           app.ListSessionInfos,
+		AddressSessionDescribe:       app.OscMethod(app.DescribeSession, AddressSessionDescribe),
+		AddressSessionTag:            app.OscMethod(app.TagSession, AddressSessionTag),
+		nsm.AddressServerAbort:       app.OscMethod(app.AbortSession, nsm.AddressServerAbort),
+		nsm.AddressServerAdd:         app.OscMethod(app.Add, nsm.AddressServerAdd),
+		nsm.AddressServerAnnounce:    app.OscMethod(app.Announce, nsm.AddressServerAnnounce),
+		nsm.AddressClientGUIHidden:   app.ClientMethod(app.ClientGUIHidden),
+		nsm.AddressClientGUIShowing:  app.ClientMethod(app.ClientGUIShowing),
+		nsm.AddressClientIsClean:     app.ClientMethod(app.ClientIsClean),
+		nsm.AddressClientIsDirty:     app.ClientMethod(app.ClientIsDirty),
+		nsm.AddressClientProgress:    app.ClientMethod(app.ClientProgress),
+		nsm.AddressClientStatus:      app.ClientMethod(app.ClientStatus),
+		nsm.AddressClientLogs:        app.ClientLogs,
+		nsm.AddressServerClients:     app.ListClients,
+		nsm.AddressServerClose:       app.OscMethod(app.CloseSession, nsm.AddressServerClose),
+		nsm.AddressServerSessions:    app.ListSessions,
+		nsm.AddressServerDuplicate:   app.OscMethod(app.DuplicateSession, nsm.AddressServerDuplicate),
+		nsm.AddressServerKill:        app.OscMethod(app.KillClients, nsm.AddressServerKill),
+		nsm.AddressServerNew:         app.OscMethod(app.NewSession, nsm.AddressServerNew),
+		nsm.AddressServerOpen:        app.OscMethod(app.OpenSession, nsm.AddressServerOpen),
+		nsm.AddressServerQuit:        app.Quit,
+		"/ping":                      app.Ping,
+		nsm.AddressServerRemove:      app.OscMethod(app.RemoveSession, nsm.AddressServerRemove),
+		nsm.AddressServerSave:        app.OscMethod(app.SaveSession, nsm.AddressServerSave),
+		nsm.AddressError:             app.ClientMethod(app.ErrorReply),
+		nsm.AddressReply:             app.ClientMethod(app.Reply),
 	}
 }
 
+// ErrorReply handles error replies from clients.
+func (app *App) ErrorReply(msg osc.Message) error {
+	return app.deliverReply(msg)
+}
+
 // Go runs a new goroutine as part of an errgroup.Group
 func (app *App) Go(f func() error) {
 	app.errgrp.Go(f)
@@ -104,6 +164,7 @@ func (app *App) initialize() error {
 	}
 	app.Conn = conn
 	app.Go(app.ServeOSC)
+	app.Go(app.handleSignals)
 	return nil
 }
 
@@ -122,6 +183,19 @@ func (app *App) OscMethod(method NsmMethod, addr string) osc.Method {
 	}
 }
 
+// ClientMethod returns an osc.Method for messages that clients send without being asked,
+// or in reply to a request, which gonzo does not reply to.
+// Errors are logged instead of returned, since they are caused by the client,
+// and an error returned from an osc.Method stops the server.
+func (app *App) ClientMethod(method osc.Method) osc.Method {
+	return func(msg osc.Message) error {
+		if err := method(msg); err != nil {
+			app.Debugf("%s from %s: %s", msg.Address, msg.Sender, err)
+		}
+		return nil
+	}
+}
+
 // Ping handles /ping messages
 func (app *App) Ping(msg osc.Message) error {
 	return errors.Wrap(app.SendTo(msg.Sender, osc.Message{Address: "/pong"}), "sending pong")
@@ -129,7 +203,34 @@ func (app *App) Ping(msg osc.Message) error {
 
 // Reply handles replies from clients.
 func (app *App) Reply(msg osc.Message) error {
-	return nil
+	return app.deliverReply(msg)
+}
+
+// Request sends a message to a client and waits for the client to reply.
+// If the client replies with an error message then an nsm.Error is returned.
+func (app *App) Request(addr net.Addr, msg osc.Message, timeout time.Duration) (osc.Message, error) {
+	var (
+		key   = replyKey(addr, msg.Address)
+		reply = make(chan osc.Message, 1)
+	)
+	app.repliesMutex.Lock()
+	app.replies[key] = append(app.replies[key], reply)
+	app.repliesMutex.Unlock()
+
+	defer app.stopWaiting(key, reply)
+
+	if err := app.SendTo(addr, msg); err != nil {
+		return osc.Message{}, errors.Wrap(err, "sending "+msg.Address)
+	}
+	select {
+	case <-time.After(timeout):
+		return osc.Message{}, errors.New("timeout waiting for reply to " + msg.Address)
+	case m := <-reply:
+		if m.Address == nsm.AddressError {
+			return m, ReadError(m)
+		}
+		return m, nil
+	}
 }
 
 // ServeOSC serves osc requests.
@@ -138,6 +239,7 @@ func (app *App) ServeOSC() error {
 }
 
 // Wait waits for all the goroutines to return nil, or for one of them to return a non-nil value, whichever happens first.
+// Wait returns nil after the application has been shut down with Quit or a signal.
 func (app *App) Wait() error {
 	return app.errgrp.Wait()
 }
@@ -169,6 +271,111 @@ func ReplySuccess(remote net.Addr, address, message string) osc.Message {
 	}
 }
 
+// forceArg is the optional argument that forces an operation
+// to proceed even if the session has unsaved changes.
+const forceArg = "force"
+
+// ReadForce returns true if the message has the force argument at the provided index.
+// The force argument is optional, so false is returned if the message does not have it.
+func ReadForce(msg osc.Message, idx int) (bool, error) {
+	if len(msg.Arguments) <= idx {
+		return false, nil
+	}
+	arg, err := msg.Arguments[idx].ReadString()
+	if err != nil {
+		return false, errors.Wrap(err, "reading force argument")
+	}
+	if arg != forceArg {
+		return false, errors.Errorf("expected %q, got %q", forceArg, arg)
+	}
+	return true, nil
+}
+
+// ReadError reads an nsm.Error from an error reply.
+func ReadError(msg osc.Message) nsm.Error {
+	if expected, got := 3, len(msg.Arguments); expected != got {
+		return nsm.NewError(nsm.ErrGeneral, "malformed error reply")
+	}
+	code, err := msg.Arguments[1].ReadInt32()
+	if err != nil {
+		return nsm.NewError(nsm.ErrGeneral, "malformed error code")
+	}
+	message, err := msg.Arguments[2].ReadString()
+	if err != nil {
+		return nsm.NewError(nsm.ErrGeneral, "malformed error message")
+	}
+	return nsm.NewError(nsm.Code(code), message)
+}
+
+// ReadReply reads the message from a successful reply.
+func ReadReply(msg osc.Message) (string, error) {
+	if expected, got := 2, len(msg.Arguments); expected != got {
+		return "", errors.Errorf("expected %d arguments in reply, got %d", expected, got)
+	}
+	message, err := msg.Arguments[1].ReadString()
+	if err != nil {
+		return "", errors.Wrap(err, "reading reply message")
+	}
+	return message, nil
+}
+
+// deliverReply delivers a reply or error reply to the request that is waiting for it.
+// Replies that no request is waiting for are ignored.
+func (app *App) deliverReply(msg osc.Message) error {
+	if len(msg.Arguments) == 0 {
+		return errors.New("expected at least 1 argument")
+	}
+	address, err := msg.Arguments[0].ReadString()
+	if err != nil {
+		return errors.Wrap(err, "reading address")
+	}
+	key := replyKey(msg.Sender, address)
+
+	app.repliesMutex.Lock()
+	waiting := app.replies[key]
+	if len(waiting) == 0 {
+		app.repliesMutex.Unlock()
+		app.Debugf("unexpected %s to %s from %s", msg.Address, address, msg.Sender)
+		return nil
+	}
+	reply := waiting[0]
+	app.removeWaiting(key, reply)
+	app.repliesMutex.Unlock()
+
+	reply <- msg // Never blocks, since each channel is buffered and receives one reply.
+	return nil
+}
+
+// stopWaiting removes a request that is no longer waiting for a reply.
+func (app *App) stopWaiting(key string, reply chan osc.Message) {
+	app.repliesMutex.Lock()
+	app.removeWaiting(key, reply)
+	app.repliesMutex.Unlock()
+}
+
+// removeWaiting removes a channel from the queue of requests that are waiting for a reply.
+// The caller must hold repliesMutex.
+func (app *App) removeWaiting(key string, reply chan osc.Message) {
+	waiting := app.replies[key]
+	for i, r := range waiting {
+		if r != reply {
+			continue
+		}
+		waiting = append(waiting[:i:i], waiting[i+1:]...)
+		break
+	}
+	if len(waiting) == 0 {
+		delete(app.replies, key)
+		return
+	}
+	app.replies[key] = waiting
+}
+
+// replyKey returns the key used to correlate a reply with the request that is waiting for it.
+func replyKey(addr net.Addr, address string) string {
+	return addr.String() + address
+}
+
 // Debugger is anything that helps us debug the app.
 type Debugger interface {
 	Debug(msg string)
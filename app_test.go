@@ -0,0 +1,143 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/scgolang/nsm"
+	"github.com/scgolang/osc"
+)
+
+// newTestApp creates an application that sends OSC from a local UDP port,
+// and a connection for a client that it can send requests to.
+func newTestApp(t *testing.T) (*App, net.Conn) {
+	t.Helper()
+
+	laddr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}
+
+	conn, err := osc.ListenUDP("udp", laddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	client, err := net.ListenUDP("udp", laddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+
+	app := &App{
+		Conn:    conn,
+		replies: map[string][]chan osc.Message{},
+	}
+	return app, client
+}
+
+// waitForRequests waits until the provided number of requests are waiting for a reply.
+func waitForRequests(t *testing.T, app *App, key string, n int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		app.repliesMutex.Lock()
+		waiting := len(app.replies[key])
+		app.repliesMutex.Unlock()
+
+		if waiting == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d requests", n)
+}
+
+func TestRequestsWithTheSameAddress(t *testing.T) {
+	var (
+		app, client = newTestApp(t)
+		addr        = client.LocalAddr()
+		key         = replyKey(addr, nsm.AddressClientSave)
+		results     = make(chan string, 2)
+	)
+	for i := 0; i < 2; i++ {
+		go func() {
+			reply, err := app.Request(addr, osc.Message{Address: nsm.AddressClientSave}, 5*time.Second)
+			if err != nil {
+				results <- err.Error()
+				return
+			}
+			result, err := ReadReply(reply)
+			if err != nil {
+				results <- err.Error()
+				return
+			}
+			results <- result
+		}()
+		// Make sure the requests are queued in order.
+		waitForRequests(t, app, key, i+1)
+	}
+	for _, result := range []string{"first", "second"} {
+		reply := ReplySuccess(addr, nsm.AddressClientSave, result)
+		reply.Sender = addr
+
+		if err := app.deliverReply(reply); err != nil {
+			t.Fatal(err)
+		}
+		if expected, got := result, <-results; expected != got {
+			t.Fatalf("expected %q, got %q", expected, got)
+		}
+	}
+	app.repliesMutex.Lock()
+	defer app.repliesMutex.Unlock()
+
+	if expected, got := 0, len(app.replies); expected != got {
+		t.Fatalf("expected %d requests waiting, got %d", expected, got)
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	var (
+		app, client = newTestApp(t)
+		addr        = client.LocalAddr()
+		key         = replyKey(addr, nsm.AddressClientSave)
+		results     = make(chan error, 1)
+	)
+	go func() {
+		_, err := app.Request(addr, osc.Message{Address: nsm.AddressClientSave}, 5*time.Second)
+		results <- err
+	}()
+	waitForRequests(t, app, key, 1)
+
+	if _, err := app.Request(addr, osc.Message{Address: nsm.AddressClientSave}, time.Millisecond); err == nil {
+		t.Fatal("expected a timeout")
+	}
+	// The request that timed out does not take the reply to the one that is still waiting.
+	reply := ReplySuccess(addr, nsm.AddressClientSave, "saved")
+	reply.Sender = addr
+
+	if err := app.deliverReply(reply); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-results; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientMethodIgnoresMalformedMessages(t *testing.T) {
+	app, client := newTestApp(t)
+
+	for _, msg := range []osc.Message{
+		{Address: nsm.AddressReply},
+		{Address: nsm.AddressError, Arguments: osc.Arguments{osc.Int(1)}},
+	} {
+		msg.Sender = client.LocalAddr()
+
+		if err := app.deliverReply(msg); err == nil {
+			t.Fatalf("expected an error for malformed %s", msg.Address)
+		}
+		if err := app.ClientMethod(app.deliverReply)(msg); err != nil {
+			t.Fatalf("expected the error to be logged, got %s", err)
+		}
+	}
+}
@@ -0,0 +1,593 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Names of the files at the top of a session archive, next to the session's directory.
+// The checksum file has the same format as the output of sha256sum,
+// and lists every regular file in the archive except itself.
+const (
+	archiveInfoFilename     = "export.json"
+	archiveChecksumFilename = "SHA256SUMS"
+)
+
+// Extensions of the supported archive formats.
+const (
+	tarGzExt = ".tar.gz"
+	tgzExt   = ".tgz"
+	zipExt   = ".zip"
+)
+
+// ArchiveInfo describes the session in an archive.
+type ArchiveInfo struct {
+	// Name is the name of the session.
+	Name string `json:"name"`
+
+	// Path is where the session's directory was when it was exported.
+	// Paths inside the session's directory in the session's state are rewritten when it is imported.
+	Path string `json:"path"`
+
+	Exported time.Time `json:"exported"`
+}
+
+// Export writes the named session to an archive at the provided path.
+// The format of the archive is determined by the path's extension, which must be .tar.gz, .tgz or .zip.
+// The archive contains the session's directory, except for the output, snapshots and history of the session.
+// Sessions that contain symbolic links are refused, since the archive would be incomplete without them.
+// Note that it is up to the caller to tell the session's clients to save.
+func (s *Sessions) Export(name, path string) error {
+	sesh, err := s.Get(name)
+	if err != nil {
+		return err
+	}
+	if !filepath.IsAbs(path) {
+		return errors.Errorf("archive path %q is not an absolute path", path)
+	}
+	if _, err := os.Stat(path); err == nil {
+		return errors.Errorf("archive already present %s", path)
+	} else if !os.IsNotExist(err) {
+		return errors.Wrapf(err, "checking for %s", path)
+	}
+	tmp := path + ".tmp"
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return errors.Wrapf(err, "creating %s", tmp)
+	}
+	if err := exportSession(sesh, f, path); err != nil {
+		_ = f.Close()      // Best effort.
+		_ = os.Remove(tmp) // Best effort.
+		return err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(tmp) // Best effort.
+		return errors.Wrapf(err, "closing %s", tmp)
+	}
+	return errors.Wrapf(os.Rename(tmp, path), "renaming %s", tmp)
+}
+
+// Import creates a new session from an archive that was created by Export.
+// The new session has the provided name, or the name of the exported session if the provided name is empty.
+// Archives are refused if any of their files would be extracted outside of the sessions home directory,
+// if they contain anything other than directories and regular files, or if any checksum does not match.
+// It returns the name of the new session.
+// Note that Import does not make the new session the current session.
+func (s *Sessions) Import(path, name string) (string, error) {
+	tmp, err := ioutil.TempDir(s.Home, ".import")
+	if err != nil {
+		return "", errors.Wrap(err, "creating temporary directory")
+	}
+	defer func() { _ = os.RemoveAll(tmp) }() // Best effort.
+
+	if err := readArchive(path, extractTo(tmp)); err != nil {
+		return "", errors.Wrapf(err, "extracting %s", path)
+	}
+	info, err := verifyArchive(tmp)
+	if err != nil {
+		return "", errors.Wrapf(err, "verifying %s", path)
+	}
+	if name == "" {
+		name = info.Name
+	}
+	if err := validateSessionName(name); err != nil {
+		return "", err
+	}
+	f := filepath.Join(s.Home, name)
+
+	if _, err := os.Stat(f); err == nil {
+		return "", errors.Errorf("session already present %s", f)
+	} else if !os.IsNotExist(err) {
+		return "", errors.Wrapf(err, "checking for %s", f)
+	}
+	extracted := filepath.Join(tmp, info.Name)
+
+	if err := rewriteStatePaths(extracted, info.Path, f); err != nil {
+		return "", errors.Wrap(err, "rewriting paths")
+	}
+	if err := os.Rename(extracted, f); err != nil {
+		return "", errors.Wrapf(err, "moving session to %s", f)
+	}
+	sesh, err := NewSession(s.ctx, s.dbg, s.sup, f)
+	if err != nil {
+		return "", errors.Wrapf(err, "could not open session %s", f)
+	}
+	s.Mu.Lock()
+	s.M[f] = sesh
+	s.Mu.Unlock()
+
+	return name, nil
+}
+
+// exportSession writes a session to an archive.
+func exportSession(sesh *Session, w io.Writer, path string) error {
+	aw, err := newArchiveWriter(w, path)
+	if err != nil {
+		return err
+	}
+	var (
+		name = sesh.Name()
+		sums = &bytes.Buffer{}
+	)
+	err = filepath.Walk(sesh.Path, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(sesh.Path, p)
+		if err != nil {
+			return errors.Wrapf(err, "getting relative path of %s", p)
+		}
+		if isMetaDir(rel) {
+			return filepath.SkipDir
+		}
+		entry := filepath.ToSlash(filepath.Join(name, rel))
+
+		switch mode := fi.Mode(); {
+		case mode.IsDir():
+			return errors.Wrapf(aw.Dir(entry, mode.Perm()), "adding %s", entry)
+		case mode.IsRegular():
+			sum, err := addFile(aw, entry, p, fi)
+			if err != nil {
+				return errors.Wrapf(err, "adding %s", entry)
+			}
+			fmt.Fprintf(sums, "%s  %s\n", sum, entry)
+			return nil
+		case mode&os.ModeSymlink != 0:
+			return errors.Errorf("%s is a symbolic link, which can not be exported", entry)
+		default:
+			// Skip sockets, pipes, devices, etc.
+			return nil
+		}
+	})
+	if err != nil {
+		return errors.Wrap(err, "adding session directory")
+	}
+	info, err := json.MarshalIndent(ArchiveInfo{Name: name, Path: sesh.Path, Exported: time.Now()}, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "encoding archive info")
+	}
+	sum := sha256.Sum256(info)
+	fmt.Fprintf(sums, "%s  %s\n", hex.EncodeToString(sum[:]), archiveInfoFilename)
+
+	if err := aw.File(archiveInfoFilename, cachePerms, int64(len(info)), bytes.NewReader(info)); err != nil {
+		return errors.Wrapf(err, "adding %s", archiveInfoFilename)
+	}
+	if err := aw.File(archiveChecksumFilename, cachePerms, int64(sums.Len()), sums); err != nil {
+		return errors.Wrapf(err, "adding %s", archiveChecksumFilename)
+	}
+	return errors.Wrap(aw.Close(), "closing archive")
+}
+
+// addFile adds a regular file to an archive and returns the hex encoded SHA-256 hash of its contents.
+func addFile(aw archiveWriter, entry, path string, fi os.FileInfo) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", errors.Wrapf(err, "opening %s", path)
+	}
+	defer func() { _ = f.Close() }() // Best effort.
+
+	h := sha256.New()
+	if err := aw.File(entry, fi.Mode().Perm(), fi.Size(), io.TeeReader(f, h)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// verifyArchive checks the files that were extracted from an archive against the archive's checksum file,
+// and returns the archive's info.
+// Every regular file must be listed in the checksum file, and everything except the archive's info
+// and checksum file must be in the exported session's directory.
+func verifyArchive(dir string) (ArchiveInfo, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, archiveInfoFilename))
+	if err != nil {
+		return ArchiveInfo{}, errors.Wrapf(err, "reading %s", archiveInfoFilename)
+	}
+	info := ArchiveInfo{}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return ArchiveInfo{}, errors.Wrapf(err, "decoding %s", archiveInfoFilename)
+	}
+	if err := validateSessionName(info.Name); err != nil {
+		return ArchiveInfo{}, err
+	}
+	sums, err := readChecksums(filepath.Join(dir, archiveChecksumFilename))
+	if err != nil {
+		return ArchiveInfo{}, err
+	}
+	return info, filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return errors.Wrapf(err, "getting relative path of %s", p)
+		}
+		rel = filepath.ToSlash(rel)
+
+		parts := strings.SplitN(rel, "/", 3)
+		switch {
+		case rel == "." || rel == archiveChecksumFilename:
+			return nil
+		case rel == info.Name:
+			if !fi.IsDir() {
+				return errors.Errorf("%s is not a directory", rel)
+			}
+			return nil
+		case rel != archiveInfoFilename && parts[0] != info.Name:
+			return errors.Errorf("unexpected file %s", rel)
+		case len(parts) > 1 && isMetaDir(parts[1]):
+			return errors.Errorf("unexpected file %s", rel)
+		case fi.IsDir():
+			return nil
+		}
+		expected, ok := sums[rel]
+		if !ok {
+			return errors.Errorf("no checksum for %s", rel)
+		}
+		actual, err := hashFile(p)
+		if err != nil {
+			return err
+		}
+		if actual != expected {
+			return errors.Errorf("checksum mismatch for %s", rel)
+		}
+		return nil
+	})
+}
+
+// readChecksums reads a checksum file in the format of sha256sum.
+// It returns the hashes keyed by path.
+func readChecksums(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "opening %s", path)
+	}
+	defer func() { _ = f.Close() }() // Best effort.
+
+	var (
+		sc   = bufio.NewScanner(f)
+		sums = map[string]string{}
+	)
+	for sc.Scan() {
+		fields := strings.SplitN(sc.Text(), "  ", 2)
+		if len(fields) != 2 {
+			return nil, errors.Errorf("malformed checksum line %q", sc.Text())
+		}
+		sums[fields[1]] = fields[0]
+	}
+	return sums, errors.Wrapf(sc.Err(), "scanning %s", path)
+}
+
+// hashFile returns the hex encoded SHA-256 hash of the contents of a file.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", errors.Wrapf(err, "opening %s", path)
+	}
+	defer func() { _ = f.Close() }() // Best effort.
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", errors.Wrapf(err, "reading %s", path)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// rewriteStatePaths replaces the path a session's directory had when it was exported
+// with its new path in the launch options in the session's state.
+func rewriteStatePaths(dir, from, to string) error {
+	f := filepath.Join(dir, stateFilename)
+
+	fd, err := os.Open(f)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "opening %s", f)
+	}
+	state, err := ReadSessionState(fd)
+	_ = fd.Close() // Best effort.
+	if err != nil {
+		return errors.Wrapf(err, "reading %s", f)
+	}
+	for clientID, cs := range state.Clients {
+		cs.LaunchOptions = rewriteLaunchOptions(cs.LaunchOptions, from, to)
+		state.Clients[clientID] = cs
+	}
+	return writeFileAtomic(f, state)
+}
+
+// rewriteLaunchOptions replaces the path from with the path to in the directory, arguments and environment of a client.
+func rewriteLaunchOptions(opts LaunchOptions, from, to string) LaunchOptions {
+	opts.Dir = rewritePath(opts.Dir, from, to)
+
+	if opts.Args != nil {
+		args := make([]string, len(opts.Args))
+		for i, arg := range opts.Args {
+			args[i] = rewritePath(arg, from, to)
+		}
+		opts.Args = args
+	}
+	if opts.Env != nil {
+		env := make([]string, len(opts.Env))
+		for i, kv := range opts.Env {
+			env[i] = rewritePath(kv, from, to)
+		}
+		opts.Env = env
+	}
+	return opts
+}
+
+// rewritePath replaces the path from with the path to in s,
+// where s is either the path itself or contains paths inside of it.
+func rewritePath(s, from, to string) string {
+	if from == "" || s == "" {
+		return s
+	}
+	if s == from {
+		return to
+	}
+	// Environment variables and options of the form key=value.
+	if strings.HasSuffix(s, "="+from) {
+		return strings.TrimSuffix(s, from) + to
+	}
+	sep := string(filepath.Separator)
+	return strings.Replace(s, from+sep, to+sep, -1)
+}
+
+// archiveWriter writes directories and regular files to an archive.
+type archiveWriter interface {
+	Dir(name string, perm os.FileMode) error
+	File(name string, perm os.FileMode, size int64, r io.Reader) error
+	Close() error
+}
+
+// newArchiveWriter returns an archiveWriter for the format that is determined by the extension of path.
+func newArchiveWriter(w io.Writer, path string) (archiveWriter, error) {
+	switch {
+	case strings.HasSuffix(path, tarGzExt), strings.HasSuffix(path, tgzExt):
+		gz := gzip.NewWriter(w)
+		return &tarArchiveWriter{gz: gz, tw: tar.NewWriter(gz)}, nil
+	case strings.HasSuffix(path, zipExt):
+		return &zipArchiveWriter{zw: zip.NewWriter(w)}, nil
+	}
+	return nil, errors.Errorf("unsupported archive %s, expected %s, %s or %s", path, tarGzExt, tgzExt, zipExt)
+}
+
+// tarArchiveWriter writes gzipped tar archives.
+type tarArchiveWriter struct {
+	gz *gzip.Writer
+	tw *tar.Writer
+}
+
+// Dir adds a directory to the archive.
+func (a *tarArchiveWriter) Dir(name string, perm os.FileMode) error {
+	return a.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     name + "/",
+		Mode:     int64(perm),
+		ModTime:  time.Now(),
+	})
+}
+
+// File adds a regular file to the archive.
+func (a *tarArchiveWriter) File(name string, perm os.FileMode, size int64, r io.Reader) error {
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     int64(perm),
+		Size:     size,
+		ModTime:  time.Now(),
+	}
+	if err := a.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := io.CopyN(a.tw, r, size)
+	return err
+}
+
+// Close closes the archive.
+func (a *tarArchiveWriter) Close() error {
+	if err := a.tw.Close(); err != nil {
+		return err
+	}
+	return a.gz.Close()
+}
+
+// zipArchiveWriter writes zip archives.
+type zipArchiveWriter struct {
+	zw *zip.Writer
+}
+
+// Dir adds a directory to the archive.
+func (a *zipArchiveWriter) Dir(name string, perm os.FileMode) error {
+	hdr := &zip.FileHeader{Name: name + "/", Method: zip.Store, Modified: time.Now()}
+	hdr.SetMode(os.ModeDir | perm)
+	_, err := a.zw.CreateHeader(hdr)
+	return err
+}
+
+// File adds a regular file to the archive.
+func (a *zipArchiveWriter) File(name string, perm os.FileMode, size int64, r io.Reader) error {
+	hdr := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()}
+	hdr.SetMode(perm)
+	w, err := a.zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	_, err = io.CopyN(w, r, size)
+	return err
+}
+
+// Close closes the archive.
+func (a *zipArchiveWriter) Close() error {
+	return a.zw.Close()
+}
+
+// extractFunc extracts an entry of an archive.
+// r is nil if the entry is a directory.
+type extractFunc func(name string, mode os.FileMode, r io.Reader) error
+
+// readArchive calls extract for every entry of an archive, in the order they appear in the archive.
+// The format of the archive is determined by the extension of path.
+// An error is returned if the archive contains anything other than directories and regular files.
+func readArchive(path string, extract extractFunc) error {
+	switch {
+	case strings.HasSuffix(path, tarGzExt), strings.HasSuffix(path, tgzExt):
+		return readTarArchive(path, extract)
+	case strings.HasSuffix(path, zipExt):
+		return readZipArchive(path, extract)
+	}
+	return errors.Errorf("unsupported archive %s, expected %s, %s or %s", path, tarGzExt, tgzExt, zipExt)
+}
+
+// readTarArchive calls extract for every entry of a gzipped tar archive.
+func readTarArchive(path string, extract extractFunc) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrapf(err, "opening %s", path)
+	}
+	defer func() { _ = f.Close() }() // Best effort.
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return errors.Wrap(err, "reading gzip header")
+	}
+	tr := tar.NewReader(gz)
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "reading tar header")
+		}
+		perm := os.FileMode(hdr.Mode).Perm()
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = extract(hdr.Name, os.ModeDir|perm, nil)
+		case tar.TypeReg:
+			err = extract(hdr.Name, perm, tr)
+		default:
+			err = errors.Errorf("%s is not a directory or regular file", hdr.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readZipArchive calls extract for every entry of a zip archive.
+func readZipArchive(path string, extract extractFunc) error {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return errors.Wrapf(err, "opening %s", path)
+	}
+	defer func() { _ = zr.Close() }() // Best effort.
+
+	for _, zf := range zr.File {
+		mode := zf.Mode()
+
+		switch {
+		case mode.IsDir():
+			err = extract(zf.Name, os.ModeDir|mode.Perm(), nil)
+		case mode.IsRegular():
+			err = extractZipFile(zf, extract)
+		default:
+			err = errors.Errorf("%s is not a directory or regular file", zf.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractZipFile calls extract for a regular file in a zip archive.
+func extractZipFile(zf *zip.File, extract extractFunc) error {
+	rc, err := zf.Open()
+	if err != nil {
+		return errors.Wrapf(err, "opening %s", zf.Name)
+	}
+	defer func() { _ = rc.Close() }() // Best effort.
+
+	return extract(zf.Name, zf.Mode().Perm(), rc)
+}
+
+// extractTo returns an extractFunc that extracts archive entries to a directory.
+// Entries that would be extracted outside of the directory are refused.
+func extractTo(dir string) extractFunc {
+	return func(name string, mode os.FileMode, r io.Reader) error {
+		target, err := archiveTarget(dir, name)
+		if err != nil {
+			return err
+		}
+		if mode.IsDir() {
+			return errors.Wrapf(os.MkdirAll(target, mode.Perm()|0700), "making directory %s", target)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), dirPerms); err != nil {
+			return errors.Wrapf(err, "making directory %s", filepath.Dir(target))
+		}
+		out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode.Perm())
+		if err != nil {
+			return errors.Wrapf(err, "creating %s", target)
+		}
+		if _, err := io.Copy(out, r); err != nil {
+			_ = out.Close() // Best effort.
+			return errors.Wrapf(err, "writing %s", target)
+		}
+		return errors.Wrapf(out.Close(), "closing %s", target)
+	}
+}
+
+// archiveTarget returns the path that an archive entry is extracted to,
+// or an error if the entry would be extracted outside of dir.
+func archiveTarget(dir, name string) (string, error) {
+	if name == "" || strings.HasPrefix(name, "/") || strings.Contains(name, `\`) || filepath.IsAbs(name) {
+		return "", errors.Errorf("refusing to extract %q", name)
+	}
+	target := filepath.Join(dir, filepath.FromSlash(name))
+
+	rel, err := filepath.Rel(dir, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errors.Errorf("refusing to extract %q outside of %s", name, dir)
+	}
+	return target, nil
+}
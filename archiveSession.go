@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/scgolang/nsm"
+	"github.com/scgolang/osc"
+)
+
+// Addresses of the requests that move sessions between machines.
+const (
+	AddressSessionExport = "/gonzo/session/export"
+	AddressSessionImport = "/gonzo/session/import"
+)
+
+// ExportSession writes a session to a .tar.gz, .tgz or .zip archive at an absolute path.
+// If the session is the current session then every client is told to save before it is exported.
+func (app *App) ExportSession(msg osc.Message) (string, nsm.Error) {
+	if expected, got := 2, len(msg.Arguments); expected != got {
+		return "", nsm.NewError(nsm.ErrGeneral, fmt.Sprintf("expected %d arguments, got %d", expected, got))
+	}
+	name, err := msg.Arguments[0].ReadString()
+	if err != nil {
+		return "", nsm.NewError(nsm.ErrGeneral, "reading session name")
+	}
+	path, err := msg.Arguments[1].ReadString()
+	if err != nil {
+		return "", nsm.NewError(nsm.ErrGeneral, "reading archive path")
+	}
+	var failed []string
+
+	if curr, err := app.sessions.Current(); err == nil && curr.Name() == name {
+		if failed, err = app.saveSession(curr); err != nil {
+			return "", nsm.NewError(nsm.ErrGeneral, err.Error())
+		}
+	}
+	if err := app.sessions.Export(name, path); err != nil {
+		return "", nsm.NewError(nsm.ErrGeneral, err.Error())
+	}
+	if len(failed) > 0 {
+		return "exported session " + name + " to " + path + " but these clients failed to save: " + strings.Join(failed, ", "), nil
+	}
+	return "exported session " + name + " to " + path, nil
+}
+
+// ImportSession creates a new session from an archive that was written by ExportSession.
+// The new session is named after the exported session unless a name is provided.
+// The new session is not opened.
+func (app *App) ImportSession(msg osc.Message) (string, nsm.Error) {
+	if min, max, got := 1, 2, len(msg.Arguments); got < min || got > max {
+		return "", nsm.NewError(nsm.ErrGeneral, fmt.Sprintf("expected %d or %d arguments, got %d", min, max, got))
+	}
+	path, err := msg.Arguments[0].ReadString()
+	if err != nil {
+		return "", nsm.NewError(nsm.ErrGeneral, "reading archive path")
+	}
+	var name string
+	if len(msg.Arguments) > 1 {
+		if name, err = msg.Arguments[1].ReadString(); err != nil {
+			return "", nsm.NewError(nsm.ErrGeneral, "reading session name")
+		}
+	}
+	imported, err := app.sessions.Import(path, name)
+	if err != nil {
+		return "", nsm.NewError(nsm.ErrCreateFailed, err.Error())
+	}
+	return "imported session " + imported + " from " + path, nil
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestSessions creates a sessions home directory in a temporary directory.
+func newTestSessions(t *testing.T) *Sessions {
+	t.Helper()
+
+	root := t.TempDir()
+	s, err := NewSessions(context.Background(), testDebugger{t}, nil, filepath.Join(root, "home"), filepath.Join(root, DefaultTemplatesDirname))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// testArchiveEntry is an entry of an archive that is crafted by a test.
+type testArchiveEntry struct {
+	name     string
+	typeflag byte
+	body     string
+	linkname string
+}
+
+// writeTestArchive writes a gzipped tar archive with the provided entries.
+func writeTestArchive(t *testing.T, path string, entries []testArchiveEntry) {
+	t.Helper()
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		gz = gzip.NewWriter(f)
+		tw = tar.NewWriter(gz)
+	)
+	for _, entry := range entries {
+		hdr := &tar.Header{
+			Typeflag: entry.typeflag,
+			Name:     entry.name,
+			Linkname: entry.linkname,
+			Mode:     int64(cachePerms),
+			Size:     int64(len(entry.body)),
+		}
+		if entry.typeflag == tar.TypeDir {
+			hdr.Mode = int64(dirPerms)
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(entry.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testArchiveInfo returns the info of a crafted archive of a session named song, and a checksum line for it.
+func testArchiveInfo(t *testing.T) (string, string) {
+	t.Helper()
+
+	info, err := json.Marshal(ArchiveInfo{Name: "song", Path: "/old/song", Exported: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(info), testChecksum(archiveInfoFilename, string(info))
+}
+
+// testChecksum returns the line of a checksum file for a file with the provided contents.
+func testChecksum(name, contents string) string {
+	sum := sha256.Sum256([]byte(contents))
+	return fmt.Sprintf("%s  %s\n", hex.EncodeToString(sum[:]), name)
+}
+
+func TestArchiveTarget(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "extract")
+
+	for _, testcase := range []struct {
+		name   string
+		target string
+	}{
+		{"song/", filepath.Join(dir, "song")},
+		{"song/session.nsm", filepath.Join(dir, "song", "session.nsm")},
+		{"song/./fake.n1/data.txt", filepath.Join(dir, "song", "fake.n1", "data.txt")},
+		{"song/../export.json", filepath.Join(dir, "export.json")},
+		{"", ""},
+		{"..", ""},
+		{"../escape.txt", ""},
+		{"song/../../escape.txt", ""},
+		{"/etc/passwd", ""},
+		{`..\escape.txt`, ""},
+		{`song\..\..\escape.txt`, ""},
+	} {
+		target, err := archiveTarget(dir, testcase.name)
+		if testcase.target == "" {
+			if err == nil {
+				t.Fatalf("expected %q to be refused, got %s", testcase.name, target)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("expected %q to be extracted, got %s", testcase.name, err)
+		}
+		if expected, got := testcase.target, target; expected != got {
+			t.Fatalf("expected %q to be extracted to %s, got %s", testcase.name, expected, got)
+		}
+	}
+}
+
+func TestImportRefusesUnsafeArchives(t *testing.T) {
+	info, infoSum := testArchiveInfo(t)
+
+	for _, testcase := range []struct {
+		name  string
+		entry testArchiveEntry
+	}{
+		{"parent directory", testArchiveEntry{name: "../escape.txt", typeflag: tar.TypeReg, body: "escape"}},
+		{"traversal inside the path", testArchiveEntry{name: "song/../../escape.txt", typeflag: tar.TypeReg, body: "escape"}},
+		{"absolute path", testArchiveEntry{name: "/escape.txt", typeflag: tar.TypeReg, body: "escape"}},
+		{"symbolic link", testArchiveEntry{name: "song/link", typeflag: tar.TypeSymlink, linkname: "../../escape.txt"}},
+		{"hard link", testArchiveEntry{name: "song/link", typeflag: tar.TypeLink, linkname: "/etc/passwd"}},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			var (
+				s    = newTestSessions(t)
+				path = filepath.Join(t.TempDir(), "song.tar.gz")
+			)
+			writeTestArchive(t, path, []testArchiveEntry{
+				{name: "song/", typeflag: tar.TypeDir},
+				testcase.entry,
+				{name: archiveInfoFilename, typeflag: tar.TypeReg, body: info},
+				{name: archiveChecksumFilename, typeflag: tar.TypeReg, body: infoSum},
+			})
+			if _, err := s.Import(path, ""); err == nil {
+				t.Fatal("expected an error")
+			}
+			for _, escape := range []string{
+				filepath.Join(s.Home, "escape.txt"),
+				filepath.Join(filepath.Dir(s.Home), "escape.txt"),
+				"/escape.txt",
+			} {
+				if _, err := os.Lstat(escape); !os.IsNotExist(err) {
+					t.Fatalf("expected %s to not exist, got %v", escape, err)
+				}
+			}
+			if _, err := os.Stat(filepath.Join(s.Home, "song")); !os.IsNotExist(err) {
+				t.Fatalf("expected no session to be imported, got %v", err)
+			}
+		})
+	}
+}
+
+func TestImportVerifiesChecksums(t *testing.T) {
+	const data = "song/fake.n1/data.txt"
+
+	info, infoSum := testArchiveInfo(t)
+
+	for _, testcase := range []struct {
+		name    string
+		sums    string
+		extra   []testArchiveEntry
+		success bool
+	}{
+		{
+			name:    "valid",
+			sums:    infoSum + testChecksum(data, "data"),
+			success: true,
+		},
+		{
+			name: "wrong checksum",
+			sums: infoSum + testChecksum(data, "tampered"),
+		},
+		{
+			name: "missing checksum",
+			sums: infoSum,
+		},
+		{
+			name: "wrong checksum for the info",
+			sums: testChecksum(archiveInfoFilename, "{}") + testChecksum(data, "data"),
+		},
+		{
+			name:  "file outside of the session",
+			sums:  infoSum + testChecksum(data, "data") + testChecksum("other.txt", "other"),
+			extra: []testArchiveEntry{{name: "other.txt", typeflag: tar.TypeReg, body: "other"}},
+		},
+		{
+			name:  "history",
+			sums:  infoSum + testChecksum(data, "data") + testChecksum("song/.git/config", "config"),
+			extra: []testArchiveEntry{{name: "song/.git/config", typeflag: tar.TypeReg, body: "config"}},
+		},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			var (
+				s    = newTestSessions(t)
+				path = filepath.Join(t.TempDir(), "song.tgz")
+			)
+			entries := []testArchiveEntry{
+				{name: "song/", typeflag: tar.TypeDir},
+				{name: "song/fake.n1/", typeflag: tar.TypeDir},
+				{name: data, typeflag: tar.TypeReg, body: "data"},
+			}
+			entries = append(entries, testcase.extra...)
+			entries = append(entries,
+				testArchiveEntry{name: archiveInfoFilename, typeflag: tar.TypeReg, body: info},
+				testArchiveEntry{name: archiveChecksumFilename, typeflag: tar.TypeReg, body: testcase.sums},
+			)
+			writeTestArchive(t, path, entries)
+
+			name, err := s.Import(path, "")
+			if !testcase.success {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				if _, err := os.Stat(filepath.Join(s.Home, "song")); !os.IsNotExist(err) {
+					t.Fatalf("expected no session to be imported, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected, got := "song", name; expected != got {
+				t.Fatalf("expected session %q, got %q", expected, got)
+			}
+			if expected, got := "data", readTestFile(t, filepath.Join(s.Home, filepath.FromSlash(data))); expected != got {
+				t.Fatalf("expected %q, got %q", expected, got)
+			}
+		})
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	for _, ext := range []string{tarGzExt, tgzExt, zipExt} {
+		t.Run(ext, func(t *testing.T) {
+			s := newTestSessions(t)
+
+			if err := s.New("song"); err != nil {
+				t.Fatal(err)
+			}
+			sesh, err := s.Get("song")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var (
+				clientDir = filepath.Join(sesh.Path, "fake.n1")
+				state     = SessionState{Clients: map[string]ClientState{
+					"n1": {LaunchOptions: LaunchOptions{
+						Dir:  clientDir,
+						Args: []string{"-config", filepath.Join(clientDir, "config.txt")},
+						Env:  []string{"FAKE_HOME=" + clientDir},
+					}},
+				}}
+			)
+			writeTestFile(t, filepath.Join(clientDir, "data.txt"), "data")
+			writeTestFile(t, filepath.Join(sesh.Path, logsDirname, "n1.stdout"), "output")
+
+			if err := writeFileAtomic(filepath.Join(sesh.Path, stateFilename), state); err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(t.TempDir(), "song"+ext)
+
+			if err := s.Export("song", path); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Export("song", path); err == nil {
+				t.Fatal("expected an error when the archive already exists")
+			}
+			name, err := s.Import(path, "copy")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected, got := "copy", name; expected != got {
+				t.Fatalf("expected session %q, got %q", expected, got)
+			}
+			imported := filepath.Join(s.Home, "copy")
+
+			if expected, got := "data", readTestFile(t, filepath.Join(imported, "fake.n1", "data.txt")); expected != got {
+				t.Fatalf("expected %q, got %q", expected, got)
+			}
+			if _, err := os.Stat(filepath.Join(imported, logsDirname)); !os.IsNotExist(err) {
+				t.Fatalf("expected client output to be left out of the archive, got %v", err)
+			}
+			fd, err := os.Open(filepath.Join(imported, stateFilename))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = fd.Close() }() // Best effort.
+
+			got, err := ReadSessionState(fd)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts := got.Clients["n1"].LaunchOptions
+			importedClientDir := filepath.Join(imported, "fake.n1")
+
+			if expected, got := importedClientDir, opts.Dir; expected != got {
+				t.Fatalf("expected dir %s, got %s", expected, got)
+			}
+			if expected, got := filepath.Join(importedClientDir, "config.txt"), opts.Args[1]; expected != got {
+				t.Fatalf("expected argument %s, got %s", expected, got)
+			}
+			if expected, got := "FAKE_HOME="+importedClientDir, opts.Env[0]; expected != got {
+				t.Fatalf("expected environment %s, got %s", expected, got)
+			}
+			// Importing the same archive again with the same name is refused.
+			if _, err := s.Import(path, "copy"); err == nil || !strings.Contains(err.Error(), "already present") {
+				t.Fatalf("expected an error about the session being present, got %v", err)
+			}
+		})
+	}
+}
+
+func TestExportRefusesLinks(t *testing.T) {
+	s := newTestSessions(t)
+
+	if err := s.New("song"); err != nil {
+		t.Fatal(err)
+	}
+	sesh, err := s.Get("song")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(sesh.Path, "fake.n1", "data.txt"), "data")
+
+	if err := os.Symlink(t.TempDir(), filepath.Join(sesh.Path, "fake.n1", "samples")); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "song"+tarGzExt)
+
+	err = s.Export("song", path)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if !strings.Contains(err.Error(), "song/fake.n1/samples") {
+		t.Fatalf("expected the error to name the link, got %s", err)
+	}
+	for _, p := range []string{path, path + ".tmp"} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Fatalf("expected %s to not exist, got %v", p, err)
+		}
+	}
+}
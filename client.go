@@ -1,6 +1,7 @@
 package main
 
 import (
+	"math/rand"
 	"net"
 
 	"github.com/scgolang/nsm"
@@ -17,10 +18,52 @@ type Client struct {
 	ExecutableName  string           `json:"executable_name"`
 	Major           int32            `json:"major"`
 	Minor           int32            `json:"minor"`
+
+	// ID is the client's ID in the session.
+	ID  string `json:"id"`
+	Pid Pid    `json:"pid"`
+
+	// Opened is true if the client replied successfully to the last open message it was sent,
+	// and OpenResult is the message or error it replied with.
+	Opened     bool   `json:"opened"`
+	OpenResult string `json:"open_result"`
+
+	// State that clients report with informational messages.
+	Dirty      bool    `json:"dirty"`
+	GUIVisible bool    `json:"gui_visible"`
+	Priority   int32   `json:"priority"`
+	Progress   float32 `json:"progress"`
+	Status     string  `json:"status"`
+}
+
+// HasCapability returns true if the client announced the provided capability, false otherwise.
+func (c Client) HasCapability(capability nsm.Capability) bool {
+	for _, cc := range c.Capabilities {
+		if cc == capability {
+			return true
+		}
+	}
+	return false
 }
 
 // Pid is a process ID.
 type Pid int32
 
-// ClientMap helps track clients by process ID.
-type ClientMap map[Pid]*Client
+// ClientMap helps track clients by client ID.
+type ClientMap map[string]*Client
+
+// clientIDPrefix is the first character of every client ID.
+const clientIDPrefix = "n"
+
+// clientIDLetters are the letters that follow the prefix of a client ID.
+const clientIDLetters = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// NewClientID returns a random client ID of the form nXXXX, which is the form that Non Session Manager uses.
+// Client IDs are used to name client directories, so they must be unique within a session.
+func NewClientID() string {
+	id := make([]byte, 4)
+	for i := range id {
+		id[i] = clientIDLetters[rand.Intn(len(clientIDLetters))]
+	}
+	return clientIDPrefix + string(id)
+}
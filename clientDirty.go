@@ -0,0 +1,24 @@
+package main
+
+import (
+	"github.com/scgolang/osc"
+)
+
+// ClientIsClean handles clients telling us they have no unsaved changes.
+func (app *App) ClientIsClean(msg osc.Message) error {
+	return app.setDirty(msg, false)
+}
+
+// ClientIsDirty handles clients telling us they have unsaved changes.
+func (app *App) ClientIsDirty(msg osc.Message) error {
+	return app.setDirty(msg, true)
+}
+
+// setDirty records the dirty state of the client that sent a message.
+func (app *App) setDirty(msg osc.Message, dirty bool) error {
+	currentSession, err := app.sessions.Current()
+	if err != nil {
+		return err
+	}
+	return currentSession.SetDirty(msg.Sender, dirty)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"github.com/pkg/errors"
+	"github.com/scgolang/nsm"
 	"github.com/scgolang/osc"
 )
 
@@ -29,7 +30,11 @@ func (app *App) ClientLogs(msg osc.Message) error {
 
 	app.Debugf("getting logs for %s", clientName)
 
-	currentSession := app.sessions.Current()
+	currentSession, err := app.sessions.Current()
+	if err != nil {
+		reply := ReplyError(nsm.AddressClientLogs, nsm.ErrNoSessionOpen, err.Error())
+		return errors.Wrap(app.SendTo(msg.Sender, reply), "sending reply")
+	}
 	reply, err := currentSession.Logs(clientName, fd)
 	if err != nil {
 		return errors.Wrap(err, "getting client logs")
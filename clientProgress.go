@@ -0,0 +1,67 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+	"github.com/scgolang/osc"
+)
+
+// ClientProgress handles clients reporting the progress of a long-running operation.
+// The progress is relayed to every controller.
+func (app *App) ClientProgress(msg osc.Message) error {
+	if expected, got := 1, len(msg.Arguments); expected != got {
+		return errors.Errorf("expected %d arguments, got %d", expected, got)
+	}
+	progress, err := msg.Arguments[0].ReadFloat32()
+	if err != nil {
+		return errors.Wrap(err, "reading progress")
+	}
+	currentSession, err := app.sessions.Current()
+	if err != nil {
+		return err
+	}
+	client, err := currentSession.SetProgress(msg.Sender, progress)
+	if err != nil {
+		return err
+	}
+	app.Notify(osc.Message{
+		Address: AddressGUIClientProgress,
+		Arguments: osc.Arguments{
+			osc.String(client.ID),
+			osc.Float(progress),
+		},
+	})
+	return nil
+}
+
+// ClientStatus handles clients reporting a status message.
+// The status message is relayed to every controller.
+func (app *App) ClientStatus(msg osc.Message) error {
+	if expected, got := 2, len(msg.Arguments); expected != got {
+		return errors.Errorf("expected %d arguments, got %d", expected, got)
+	}
+	priority, err := msg.Arguments[0].ReadInt32()
+	if err != nil {
+		return errors.Wrap(err, "reading priority")
+	}
+	status, err := msg.Arguments[1].ReadString()
+	if err != nil {
+		return errors.Wrap(err, "reading status message")
+	}
+	currentSession, err := app.sessions.Current()
+	if err != nil {
+		return err
+	}
+	client, err := currentSession.SetStatus(msg.Sender, priority, status)
+	if err != nil {
+		return err
+	}
+	app.Notify(osc.Message{
+		Address: AddressGUIClientMessage,
+		Arguments: osc.Arguments{
+			osc.String(client.ID),
+			osc.Int(priority),
+			osc.String(status),
+		},
+	})
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/scgolang/nsm"
+	"github.com/scgolang/osc"
+)
+
+// errUnsavedChanges is returned when a session with unsaved changes would be closed.
+var errUnsavedChanges = errors.New("session has unsaved changes, use " + forceArg + " to discard them")
+
+// AbortSession closes the current session without saving.
+// If the session has unsaved changes it is only closed if the force argument is provided.
+func (app *App) AbortSession(msg osc.Message) (string, nsm.Error) {
+	app.sessionMutex.Lock()
+	defer app.sessionMutex.Unlock()
+
+	force, err := ReadForce(msg, 0)
+	if err != nil {
+		return "", nsm.NewError(nsm.ErrGeneral, err.Error())
+	}
+	sesh, err := app.sessions.Current()
+	if err != nil {
+		return "", nsm.NewError(nsm.ErrNoSessionOpen, err.Error())
+	}
+	app.Debugf("aborting session %s", sesh.Name())
+
+	if sesh.Dirty() && !force {
+		return "", nsm.NewError(nsm.ErrUnsavedChanges, errUnsavedChanges.Error())
+	}
+	if err := app.sessions.Close(app.GracePeriod); err != nil {
+		return "", nsm.NewError(nsm.ErrGeneral, err.Error())
+	}
+	return "aborted session " + sesh.Name(), nil
+}
+
+// CloseSession saves the current session then closes it.
+// If the session still has unsaved changes after saving (e.g. because a client failed to save)
+// it is only closed if the force argument is provided.
+func (app *App) CloseSession(msg osc.Message) (string, nsm.Error) {
+	app.sessionMutex.Lock()
+	defer app.sessionMutex.Unlock()
+
+	force, err := ReadForce(msg, 0)
+	if err != nil {
+		return "", nsm.NewError(nsm.ErrGeneral, err.Error())
+	}
+	sesh, err := app.sessions.Current()
+	if err != nil {
+		return "", nsm.NewError(nsm.ErrNoSessionOpen, err.Error())
+	}
+	app.Debugf("closing session %s", sesh.Name())
+
+	failed, err := app.closeSession(sesh, nil, force)
+	if err == errUnsavedChanges {
+		return "", nsm.NewError(nsm.ErrUnsavedChanges, err.Error())
+	}
+	if err != nil {
+		return "", nsm.NewError(nsm.ErrGeneral, err.Error())
+	}
+	if len(failed) > 0 {
+		return "closed session " + sesh.Name() + " but these clients failed to save: " + strings.Join(failed, ", "), nil
+	}
+	return "closed session " + sesh.Name(), nil
+}
+
+// closeCurrentSession saves and closes the current session, if there is one.
+// If the current session still has unsaved changes after saving then it is only closed if force is true.
+// Clients that can switch sessions are moved to next, if it is not nil, instead of being stopped.
+func (app *App) closeCurrentSession(next *Session, force bool) nsm.Error {
+	curr, err := app.sessions.Current()
+	if err != nil {
+		return nil
+	}
+	failed, err := app.closeSession(curr, next, force)
+	if err == errUnsavedChanges {
+		return nsm.NewError(nsm.ErrUnsavedChanges, err.Error())
+	}
+	if err != nil {
+		return nsm.NewError(nsm.ErrGeneral, err.Error())
+	}
+	if len(failed) > 0 {
+		app.Debugf("these clients failed to save: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// closeSession saves the current session then closes it.
+// If the session still has unsaved changes after saving then errUnsavedChanges
+// is returned and the session is left open, unless force is true.
+// Clients that can switch sessions are moved to next, if it is not nil, instead of being stopped.
+// It returns a description of each client that failed to save.
+func (app *App) closeSession(sesh, next *Session, force bool) ([]string, error) {
+	failed, err := app.saveSession(sesh)
+	if err != nil {
+		return failed, err
+	}
+	if sesh.Dirty() && !force {
+		return failed, errUnsavedChanges
+	}
+	if next != nil {
+		if switched := sesh.Switch(next); len(switched) > 0 {
+			app.Debugf("switched clients to session %s: %s", next.Name(), strings.Join(switched, ", "))
+		}
+	}
+	return failed, errors.Wrap(app.sessions.Close(app.GracePeriod), "closing session")
+}
@@ -4,19 +4,32 @@ import (
 	"flag"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 const (
 	// DefaultPort is the default listening port.
 	DefaultPort = 56070
+
+	// DefaultGracePeriod is the default amount of time clients are given
+	// to exit after being asked to terminate.
+	DefaultGracePeriod = 5 * time.Second
+
+	// DefaultLaunchTimeout is the default amount of time launched clients
+	// are given to announce themselves.
+	DefaultLaunchTimeout = 5 * time.Second
 )
 
 // Config provides configuration for the application.
 type Config struct {
-	Home      string `json:"home"`
-	Host      string `json:"host"`
-	Port      int    `json:"port"`
-	DebugFlag bool   `json:"debug"`
+	Home          string        `json:"home"`
+	Templates     string        `json:"templates"`
+	Host          string        `json:"host"`
+	Port          int           `json:"port"`
+	DebugFlag     bool          `json:"debug"`
+	GracePeriod   time.Duration `json:"grace_period"`
+	LaunchTimeout time.Duration `json:"launch_timeout"`
+	History       bool          `json:"history"`
 }
 
 // NewConfig creates a new config from command line flags.
@@ -26,9 +39,17 @@ func NewConfig() (Config, error) {
 		defaultHome = filepath.Join(os.Getenv("HOME"), "gonzo-sessions")
 	)
 	flag.StringVar(&c.Home, "home", defaultHome, "Session manager's home directory")
+	flag.StringVar(&c.Templates, "templates", "", "Directory of session templates (defaults to "+DefaultTemplatesDirname+" next to the home directory)")
 	flag.StringVar(&c.Host, "h", "127.0.0.1", "host")
 	flag.IntVar(&c.Port, "p", DefaultPort, "port")
 	flag.BoolVar(&c.DebugFlag, "debug", false, "Print debugging output")
+	flag.DurationVar(&c.GracePeriod, "grace", DefaultGracePeriod, "Time clients are given to exit before they are killed")
+	flag.DurationVar(&c.LaunchTimeout, "launch-timeout", DefaultLaunchTimeout, "Time launched clients are given to announce themselves")
+	flag.BoolVar(&c.History, "history", false, "Keep the history of every session in a git repository")
 	flag.Parse()
+
+	if c.Templates == "" {
+		c.Templates = filepath.Join(filepath.Dir(c.Home), DefaultTemplatesDirname)
+	}
 	return c, nil
 }
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net"
+
+	"github.com/scgolang/nsm"
+	"github.com/scgolang/osc"
+)
+
+// Addresses used to communicate with controllers.
+const (
+	AddressGUIAnnounce         = "/nsm/gui/gui_announce"
+	AddressGUIClientGUIVisible = "/nsm/gui/client/gui_visible"
+	AddressGUIClientMessage    = "/nsm/gui/client/message"
+	AddressGUIClientProgress   = "/nsm/gui/client/progress"
+	AddressGUISessionLoaded    = "/nsm/gui/session/loaded"
+)
+
+// AnnounceController registers the sender as a controller.
+// Controllers are notified about changes to the clients in the current session.
+func (app *App) AnnounceController(msg osc.Message) (string, nsm.Error) {
+	app.Debugf("registering controller %s", msg.Sender)
+
+	app.controllersMutex.Lock()
+	app.controllers[msg.Sender.String()] = msg.Sender
+	app.controllersMutex.Unlock()
+
+	return "registered controller " + msg.Sender.String(), nil
+}
+
+// Notify sends a message to every registered controller.
+func (app *App) Notify(msg osc.Message) {
+	addrs := []net.Addr{}
+	app.controllersMutex.RLock()
+	for _, addr := range app.controllers {
+		addrs = append(addrs, addr)
+	}
+	app.controllersMutex.RUnlock()
+
+	for _, addr := range addrs {
+		if err := app.SendTo(addr, msg); err != nil {
+			app.Debugf("notifying controller %s: %s", addr, err)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// copyDir recursively copies the directory at src to dst.
+// dst must not exist.
+func copyDir(src, dst string) error {
+	return copyTree(src, dst, nil)
+}
+
+// copySessionDir copies a session's directory to dst,
+// except for the output, snapshots and history of the session.
+// dst must not exist.
+func copySessionDir(src, dst string) error {
+	return copyTree(src, dst, isMetaDir)
+}
+
+// copyTree recursively copies the directory at src to dst,
+// skipping any directory whose path relative to src is matched by skip.
+func copyTree(src, dst string, skip func(rel string) bool) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return errors.Wrapf(err, "getting relative path of %s", path)
+		}
+		if skip != nil && info.IsDir() && skip(rel) {
+			return filepath.SkipDir
+		}
+		target := filepath.Join(dst, rel)
+
+		switch mode := info.Mode(); {
+		case mode.IsDir():
+			return errors.Wrapf(os.Mkdir(target, mode.Perm()), "making directory %s", target)
+		case mode&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return errors.Wrapf(err, "reading link %s", path)
+			}
+			return errors.Wrapf(os.Symlink(link, target), "creating link %s", target)
+		case mode.IsRegular():
+			return errors.Wrapf(copyFile(path, target, mode.Perm()), "copying %s", path)
+		default:
+			// Skip sockets, pipes, devices, etc.
+			return nil
+		}
+	})
+}
+
+// copyFile copies the regular file at src to dst.
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return errors.Wrapf(err, "opening %s", src)
+	}
+	defer func() { _ = in.Close() }() // Best effort.
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return errors.Wrapf(err, "creating %s", dst)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close() // Best effort.
+		return errors.Wrapf(err, "writing %s", dst)
+	}
+	return errors.Wrapf(out.Close(), "closing %s", dst)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/scgolang/nsm"
+	"github.com/scgolang/osc"
+)
+
+// Addresses of the requests that change the metadata of a session.
+const (
+	AddressSessionDescribe = "/gonzo/session/describe"
+	AddressSessionTag      = "/gonzo/session/tag"
+)
+
+// DescribeSession sets the description of a session.
+// The description is cleared if the request does not have one.
+func (app *App) DescribeSession(msg osc.Message) (string, nsm.Error) {
+	if min, max, got := 1, 2, len(msg.Arguments); got < min || got > max {
+		return "", nsm.NewError(nsm.ErrGeneral, fmt.Sprintf("expected %d or %d arguments, got %d", min, max, got))
+	}
+	name, err := msg.Arguments[0].ReadString()
+	if err != nil {
+		return "", nsm.NewError(nsm.ErrGeneral, "reading session name")
+	}
+	var description string
+	if len(msg.Arguments) > 1 {
+		if description, err = msg.Arguments[1].ReadString(); err != nil {
+			return "", nsm.NewError(nsm.ErrGeneral, "reading description")
+		}
+	}
+	sesh, err := app.sessions.Get(name)
+	if err != nil {
+		return "", nsm.NewError(nsm.ErrNoSuchFile, err.Error())
+	}
+	if err := sesh.SetDescription(description); err != nil {
+		return "", nsm.NewError(nsm.ErrGeneral, err.Error())
+	}
+	return "described session " + name, nil
+}
+
+// TagSession replaces the tags of a session with the tags in the request.
+// The tags are cleared if the request does not have any.
+func (app *App) TagSession(msg osc.Message) (string, nsm.Error) {
+	if min, got := 1, len(msg.Arguments); got < min {
+		return "", nsm.NewError(nsm.ErrGeneral, fmt.Sprintf("expected at least %d argument, got %d", min, got))
+	}
+	name, err := msg.Arguments[0].ReadString()
+	if err != nil {
+		return "", nsm.NewError(nsm.ErrGeneral, "reading session name")
+	}
+	tags := []string{}
+	for i, arg := range msg.Arguments[1:] {
+		tag, err := arg.ReadString()
+		if err != nil {
+			return "", nsm.NewError(nsm.ErrGeneral, fmt.Sprintf("reading tag %d", i+1))
+		}
+		tags = append(tags, tag)
+	}
+	sesh, err := app.sessions.Get(name)
+	if err != nil {
+		return "", nsm.NewError(nsm.ErrNoSuchFile, err.Error())
+	}
+	if err := sesh.SetTags(tags); err != nil {
+		return "", nsm.NewError(nsm.ErrGeneral, err.Error())
+	}
+	return "tagged session " + name, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/scgolang/nsm"
+	"github.com/scgolang/osc"
+)
+
+// DuplicateSession saves the current session, copies it to a new session,
+// then closes the current session and opens the copy.
+// Clients that can switch sessions keep running and are told to open their projects in the copy.
+// The reply is sent after every client has replied to the open message or timed out.
+func (app *App) DuplicateSession(msg osc.Message) (string, nsm.Error) {
+	app.sessionMutex.Lock()
+	defer app.sessionMutex.Unlock()
+
+	const code = nsm.ErrCreateFailed
+
+	if expected, got := 1, len(msg.Arguments); expected != got {
+		return "", nsm.NewError(code, fmt.Sprintf("expected %d arguments, got %d", expected, got))
+	}
+	name, err := msg.Arguments[0].ReadString()
+	if err != nil {
+		return "", nsm.NewError(code, "reading string from message")
+	}
+	curr, err := app.sessions.Current()
+	if err != nil {
+		return "", nsm.NewError(nsm.ErrNoSessionOpen, err.Error())
+	}
+	app.Debugf("duplicating session %s as %s", curr.Name(), name)
+
+	failed, err := app.saveSession(curr)
+	if err != nil {
+		return "", nsm.NewError(nsm.ErrGeneral, err.Error())
+	}
+	if len(failed) > 0 {
+		return "", nsm.NewError(nsm.ErrGeneral, "these clients failed to save: "+strings.Join(failed, ", "))
+	}
+	if err := app.sessions.Duplicate(curr, name); err != nil {
+		return "", nsm.NewError(code, err.Error())
+	}
+	next, err := app.sessions.Get(name)
+	if err != nil {
+		return "", nsm.NewError(nsm.ErrNoSuchFile, err.Error())
+	}
+	if switched := curr.Switch(next); len(switched) > 0 {
+		app.Debugf("switched clients to session %s: %s", name, strings.Join(switched, ", "))
+	}
+	if err := app.sessions.Close(app.GracePeriod); err != nil {
+		return "", nsm.NewError(nsm.ErrGeneral, err.Error())
+	}
+	if err := app.sessions.Open(name); err != nil {
+		return "", nsm.NewError(nsm.ErrNoSuchFile, err.Error())
+	}
+	sesh, err := app.sessions.Current()
+	if err != nil {
+		return "", nsm.NewError(nsm.ErrNoSuchFile, err.Error())
+	}
+	if failed := app.launchSession(sesh); len(failed) > 0 {
+		return "duplicated session " + curr.Name() + " as " + name + " but these clients failed: " + strings.Join(failed, ", "), nil
+	}
+	return "duplicated session " + curr.Name() + " as " + name, nil
+}
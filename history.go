@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// gitDirname is the name of the directory that makes a session's directory a git repository.
+// Sessions that are git repositories keep a history of their saves.
+const gitDirname = ".git"
+
+// historyExcludes are the patterns of files in a session's directory that are not part of its history.
+// The session's metadata is excluded since it changes every time the session is opened or saved.
+var historyExcludes = []string{
+	logsDirname + "/",
+	snapshotsDirname + "/",
+	"/" + metaFilename,
+	"*" + stdoutExt,
+	"*" + stderrExt,
+	"*.tmp",
+}
+
+// Identity used for commits if git has not been configured with one.
+const (
+	historyUserName  = ApplicationName
+	historyUserEmail = ApplicationName + "@localhost"
+)
+
+// HistoryEntry is a save in a session's history.
+type HistoryEntry struct {
+	Commit  string    `json:"commit"`
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+// FileChange is a file that changed between two saves in a session's history.
+// Status is the status letter that git uses, e.g. A for added, D for deleted and M for modified.
+type FileChange struct {
+	Status string `json:"status"`
+	Path   string `json:"path"`
+}
+
+// HasHistory returns true if the session's directory is a git repository, false otherwise.
+func (s *Session) HasHistory() bool {
+	_, err := os.Stat(filepath.Join(s.Path, gitDirname))
+	return err == nil
+}
+
+// InitHistory makes the session's directory a git repository.
+// The output of the session's clients and the session's snapshots are excluded from the history.
+func (s *Session) InitHistory() error {
+	if _, err := s.git("init", "-q"); err != nil {
+		return err
+	}
+	return errors.Wrap(writeHistoryExcludes(s.Path), "writing excludes")
+}
+
+// Commit commits everything in the session's directory to its history.
+// It returns the abbreviated hash of the commit, or an empty string if nothing changed since the last commit.
+func (s *Session) Commit(message string) (string, error) {
+	if _, err := s.git("add", "-A"); err != nil {
+		return "", err
+	}
+	status, err := s.git("status", "--porcelain")
+	if err != nil {
+		return "", err
+	}
+	if len(bytes.TrimSpace(status)) == 0 {
+		return "", nil
+	}
+	args := []string{"commit", "-q", "-m", message}
+	if _, err := s.git("config", "user.email"); err != nil {
+		args = append([]string{"-c", "user.name=" + historyUserName, "-c", "user.email=" + historyUserEmail}, args...)
+	}
+	if _, err := s.git(args...); err != nil {
+		return "", err
+	}
+	commit, err := s.git("rev-parse", "--short", "HEAD")
+	return string(bytes.TrimSpace(commit)), err
+}
+
+// History returns the saves in the session's history, newest first.
+func (s *Session) History() ([]HistoryEntry, error) {
+	out, err := s.git("log", "--format=%h%x00%cI%x00%s")
+	if err != nil {
+		// A repository without any commits has no history.
+		if _, headErr := s.git("rev-parse", "--verify", "-q", "HEAD"); headErr != nil {
+			return []HistoryEntry{}, nil
+		}
+		return nil, err
+	}
+	entries := []HistoryEntry{}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.SplitN(line, "\x00", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, fields[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing time of commit %s", fields[0])
+		}
+		entries = append(entries, HistoryEntry{Commit: fields[0], Time: t, Message: fields[2]})
+	}
+	return entries, nil
+}
+
+// Diff returns the files that changed between two saves in the session's history.
+func (s *Session) Diff(from, to string) ([]FileChange, error) {
+	for _, commit := range []string{from, to} {
+		if err := validateCommit(commit); err != nil {
+			return nil, err
+		}
+	}
+	out, err := s.git("diff", "--name-status", "--no-renames", from, to, "--")
+	if err != nil {
+		return nil, err
+	}
+	changes := []FileChange{}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.SplitN(line, "\t", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		changes = append(changes, FileChange{Status: fields[0], Path: fields[1]})
+	}
+	return changes, nil
+}
+
+// Checkout creates a new session with the provided name from a save in the history of a session.
+// The new session is a git repository whose history ends with the save.
+// Paths in the launch options that point into the session are rewritten to point into the new session.
+// Note that Checkout does not make the new session the current session.
+func (s *Sessions) Checkout(src *Session, commit, name string) error {
+	if err := validateSessionName(name); err != nil {
+		return err
+	}
+	if err := validateCommit(commit); err != nil {
+		return err
+	}
+	f := filepath.Join(s.Home, name)
+
+	if _, err := os.Stat(f); err == nil {
+		return errors.Errorf("session already present %s", f)
+	} else if !os.IsNotExist(err) {
+		return errors.Wrapf(err, "checking for %s", f)
+	}
+	if _, err := git(s.Home, "clone", "-q", "--no-checkout", src.Path, f); err != nil {
+		_ = os.RemoveAll(f) // Best effort.
+		return err
+	}
+	if err := checkout(f, commit); err != nil {
+		_ = os.RemoveAll(f) // Best effort.
+		return err
+	}
+	if err := rewriteStatePaths(f, src.Path, f); err != nil {
+		_ = os.RemoveAll(f) // Best effort.
+		return errors.Wrap(err, "rewriting paths")
+	}
+	sesh, err := NewSession(s.ctx, s.dbg, s.sup, f)
+	if err != nil {
+		return errors.Wrapf(err, "could not open session %s", f)
+	}
+	if err := sesh.created(); err != nil {
+		return errors.Wrapf(err, "writing metadata for %s", f)
+	}
+	s.Mu.Lock()
+	s.M[f] = sesh
+	s.Mu.Unlock()
+
+	return nil
+}
+
+// checkout checks out a commit in a session directory that was cloned from another session,
+// and detaches it from the session it was cloned from.
+func checkout(dir, commit string) error {
+	if _, err := git(dir, "reset", "-q", "--hard", commit); err != nil {
+		return err
+	}
+	if _, err := git(dir, "remote", "remove", "origin"); err != nil {
+		return err
+	}
+	return errors.Wrap(writeHistoryExcludes(dir), "writing excludes")
+}
+
+// git runs git in the session's directory and returns its output.
+// If git fails then the returned error includes what git wrote to stderr.
+func (s *Session) git(args ...string) ([]byte, error) {
+	return git(s.Path, args...)
+}
+
+// git runs git in the provided directory and returns its output.
+func git(dir string, args ...string) ([]byte, error) {
+	var (
+		cmd    = exec.Command("git", args...)
+		stderr bytes.Buffer
+	)
+	cmd.Dir = dir
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return out, errors.Wrapf(err, "git %s: %s", args[0], strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// validateCommit returns an error if a commit can not be safely passed to git,
+// since git would interpret it as an option if it started with a dash.
+func validateCommit(commit string) error {
+	if commit == "" || strings.HasPrefix(commit, "-") {
+		return errors.Errorf("invalid commit %q", commit)
+	}
+	return nil
+}
+
+// writeHistoryExcludes writes the patterns of files that are excluded from a session's history
+// to the git repository in the session's directory.
+func writeHistoryExcludes(dir string) error {
+	info := filepath.Join(dir, gitDirname, "info")
+	if err := os.MkdirAll(info, dirPerms); err != nil {
+		return errors.Wrapf(err, "making directory %s", info)
+	}
+	f := filepath.Join(info, "exclude")
+	return errors.Wrapf(writeFileAtomic(f, bytes.NewBufferString(strings.Join(historyExcludes, "\n")+"\n")), "writing %s", f)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckout(t *testing.T) {
+	s := newTestSessions(t)
+
+	if err := s.New("song"); err != nil {
+		t.Fatal(err)
+	}
+	src, err := s.Get("song")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := src.InitHistory(); err != nil {
+		t.Fatal(err)
+	}
+	writeTestLaunchOptions(t, src, "n1")
+
+	commit, err := src.Commit("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(src.Path, "fake.n1", "config.txt"), "changed")
+
+	if _, err := src.Commit("second"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Checkout(src, commit, "copy"); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(s.Home, "copy")
+
+	checkTestLaunchOptions(t, dst, "n1")
+
+	if expected, got := "config", readTestFile(t, filepath.Join(dst, "fake.n1", "config.txt")); expected != got {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+	for _, commit := range []string{"", "-f", "nonexistent"} {
+		if err := s.Checkout(src, commit, "other"); err == nil {
+			t.Fatalf("expected an error checking out %q", commit)
+		}
+		if _, err := os.Stat(filepath.Join(s.Home, "other")); !os.IsNotExist(err) {
+			t.Fatalf("expected no session to be left after checking out %q, got %v", commit, err)
+		}
+	}
+}
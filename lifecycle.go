@@ -0,0 +1,177 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+)
+
+// LifecycleState is a stage in the lifecycle of a client's process.
+// A client moves from launching to announced to opened,
+// and ends up either stopped or crashed when its process exits.
+type LifecycleState string
+
+// Lifecycle states.
+const (
+	// StateLaunching means the client's process has been started but the client has not announced itself.
+	StateLaunching LifecycleState = "launching"
+
+	// StateAnnounced means the client has announced itself but has not opened its project.
+	StateAnnounced LifecycleState = "announced"
+
+	// StateOpened means the client replied successfully to the last open message it was sent.
+	StateOpened LifecycleState = "opened"
+
+	// StateStopped means the client's process was stopped by gonzo or exited successfully.
+	StateStopped LifecycleState = "stopped"
+
+	// StateCrashed means the client's process failed without being stopped by gonzo.
+	StateCrashed LifecycleState = "crashed"
+)
+
+// Lifecycle records the lifecycle of a client's process.
+type Lifecycle struct {
+	State LifecycleState `json:"state"`
+	Pid   Pid            `json:"pid"`
+
+	// Started is when the process was launched,
+	// or when the client announced itself if it was not launched by gonzo.
+	Started time.Time `json:"started"`
+
+	// ExitCode and Signal describe how the process exited.
+	// ExitCode is -1 if the process was killed by a signal, and Signal is 0 if it was not.
+	ExitCode int            `json:"exit_code"`
+	Signal   syscall.Signal `json:"signal,omitempty"`
+
+	// Changed is when the state last changed.
+	Changed time.Time `json:"changed"`
+}
+
+// ClientInfo describes a client of a session, whether or not it is running.
+// The embedded Client is only filled in with the client's announcement while the client is running.
+type ClientInfo struct {
+	Client
+	Executable string    `json:"executable"`
+	Process    Lifecycle `json:"process"`
+}
+
+// ClientInfos returns the clients that the session has launched or that have announced themselves,
+// sorted by client ID.
+// Clients that have exited are only included if they are in the session's manifest,
+// and they are named after their manifest entry.
+func (s *Session) ClientInfos() []ClientInfo {
+	var (
+		clients = s.Clients()
+		entries = map[string]ManifestEntry{}
+		infos   = []ClientInfo{}
+	)
+	for _, entry := range s.Manifest() {
+		entries[entry.ID] = entry
+	}
+	s.sessionClientsMutex.RLock()
+	for clientID, sc := range s.sessionClients {
+		client, running := clients[clientID]
+		entry, inManifest := entries[clientID]
+		if !running && !inManifest && !sc.lifecycle.running() {
+			continue
+		}
+		info := ClientInfo{
+			Client: Client{
+				ApplicationName: entry.Name,
+				ExecutableName:  filepath.Base(sc.executable),
+				ID:              clientID,
+				Pid:             sc.lifecycle.Pid,
+			},
+			Executable: sc.executable,
+			Process:    sc.lifecycle,
+		}
+		if running {
+			info.Client = *client
+		}
+		if info.ApplicationName == "" {
+			info.ApplicationName = info.ExecutableName
+		}
+		if info.Executable == "" {
+			info.Executable = info.ExecutableName
+		}
+		infos = append(infos, info)
+	}
+	s.sessionClientsMutex.RUnlock()
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ID < infos[j].ID
+	})
+	return infos
+}
+
+// running returns true if the process is in a state before it exits.
+func (l Lifecycle) running() bool {
+	return l.State != StateStopped && l.State != StateCrashed
+}
+
+// setState changes the state of a client's lifecycle.
+func (l *Lifecycle) setState(state LifecycleState) {
+	l.State = state
+	l.Changed = time.Now()
+}
+
+// launched records that a client's process has been started.
+func (s *Session) launched(clientID string, p *process) {
+	s.sessionClientsMutex.Lock()
+	s.sessionClients[clientID] = &sessionClient{
+		executable: p.Path,
+		lifecycle: Lifecycle{
+			State:   StateLaunching,
+			Pid:     Pid(p.Process.Pid),
+			Started: p.started,
+			Changed: p.started,
+		},
+	}
+	s.sessionClientsMutex.Unlock()
+}
+
+// transition changes the lifecycle state of a client, if the client's process has the provided pid.
+func (s *Session) transition(clientID string, pid Pid, state LifecycleState) {
+	s.sessionClientsMutex.Lock()
+	defer s.sessionClientsMutex.Unlock()
+
+	sc, ok := s.sessionClients[clientID]
+	if !ok {
+		// The client was not launched by gonzo, so its lifecycle starts when it announces itself.
+		sc = &sessionClient{lifecycle: Lifecycle{Pid: pid, Started: time.Now()}}
+		s.sessionClients[clientID] = sc
+	}
+	if sc.lifecycle.Pid != pid {
+		return
+	}
+	sc.lifecycle.setState(state)
+}
+
+// exitLifecycle records how a client's process exited in its lifecycle.
+// stopped should be true if the process was stopped by gonzo.
+func (s *Session) exitLifecycle(clientID string, p *process, stopped bool) {
+	code := p.exitCode()
+
+	state := StateCrashed
+	if stopped || code == 0 {
+		state = StateStopped
+	}
+	var sig syscall.Signal
+	if p.ProcessState != nil {
+		if ws, ok := p.ProcessState.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			sig = ws.Signal()
+		}
+	}
+	s.sessionClientsMutex.Lock()
+	defer s.sessionClientsMutex.Unlock()
+
+	sc, ok := s.sessionClients[clientID]
+	if !ok || sc.lifecycle.Pid != Pid(p.Process.Pid) {
+		return
+	}
+	sc.exitStatus = p.exitStatus()
+	sc.lifecycle.ExitCode = code
+	sc.lifecycle.Signal = sig
+	sc.lifecycle.setState(state)
+}
@@ -1,28 +1,75 @@
 package main
 
 import (
+	"encoding/json"
 	"net"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/scgolang/nsm"
 	"github.com/scgolang/osc"
 )
 
+// clientsJSONArg is the optional argument of a clients request
+// that asks for the list of clients to be encoded as JSON.
+const clientsJSONArg = "json"
+
 // ListClients replies with a list of clients.
+// If the request has the json argument then the reply contains a single string,
+// which is the JSON encoding of the list of clients.
 func (app *App) ListClients(msg osc.Message) error {
 	app.Debug("listing clients")
 
+	asJSON, err := readClientsJSON(msg)
+	if err != nil {
+		reply := ReplyError(nsm.AddressServerClients, nsm.ErrGeneral, err.Error())
+		return errors.Wrap(app.SendTo(msg.Sender, reply), "sending reply")
+	}
 	// Read the clients from disk and send each one as a reply message.
-	if err := app.sendClients(msg.Sender); err != nil {
+	if err := app.sendClients(msg.Sender, asJSON); err != nil {
 		return errors.Wrap(err, "sending clients")
 	}
 	return nil
 }
 
+// readClientsJSON returns true if a clients request has the json argument.
+func readClientsJSON(msg osc.Message) (bool, error) {
+	if max, got := 1, len(msg.Arguments); got > max {
+		return false, errors.Errorf("expected at most %d argument, got %d", max, got)
+	}
+	if len(msg.Arguments) == 0 {
+		return false, nil
+	}
+	arg, err := msg.Arguments[0].ReadString()
+	if err != nil {
+		return false, errors.Wrap(err, "reading argument")
+	}
+	if arg != clientsJSONArg {
+		return false, errors.Errorf("expected %q, got %q", clientsJSONArg, arg)
+	}
+	return true, nil
+}
+
 // sendClients sends the list of clients as individual reply messages.
-func (app *App) sendClients(addr net.Addr) error {
-	clients := app.sessions.Current().Clients()
+// Each client is described by its application name, capabilities, executable name, api version, pid,
+// whether it is dirty, whether its GUI is visible, its ID, and its lifecycle:
+// state, start time, exit code, signal and the time its state last changed.
+// Times are formatted as RFC 3339.
+func (app *App) sendClients(addr net.Addr, asJSON bool) error {
+	currentSession, err := app.sessions.Current()
+	if err != nil {
+		reply := ReplyError(nsm.AddressServerClients, nsm.ErrNoSessionOpen, err.Error())
+		return errors.Wrap(app.SendTo(addr, reply), "sending reply")
+	}
+	clients := currentSession.ClientInfos()
 
+	if asJSON {
+		data, err := json.Marshal(clients)
+		if err != nil {
+			return errors.Wrap(err, "encoding clients")
+		}
+		return errors.Wrapf(app.SendTo(addr, ReplySuccess(addr, nsm.AddressServerClients, string(data))), "send %s reply", nsm.AddressServerClients)
+	}
 	msg := osc.Message{
 		Address: nsm.AddressReply,
 		Arguments: osc.Arguments{
@@ -31,16 +78,34 @@ func (app *App) sendClients(addr net.Addr) error {
 		},
 	}
 
-	for pid, client := range clients {
+	for _, client := range clients {
 		msg.Arguments = append(msg.Arguments, []osc.Argument{
 			osc.String(client.ApplicationName),
-			osc.String(client.Capabilities.String()),
+			osc.String(capabilitiesArg(client.Capabilities)),
 			osc.String(client.ExecutableName),
 			osc.Int(client.Major),
 			osc.Int(client.Minor),
-			osc.Int(pid),
+			osc.Int(client.Process.Pid),
+			osc.Bool(client.Dirty),
+			osc.Bool(client.GUIVisible),
+			osc.String(client.ID),
+			osc.String(string(client.Process.State)),
+			osc.String(client.Process.Started.Format(time.RFC3339)),
+			osc.Int(client.Process.ExitCode),
+			osc.Int(client.Process.Signal),
+			osc.String(client.Process.Changed.Format(time.RFC3339)),
 		}...)
-		app.Debugf("added client to message pid=%d name=%s", pid, client.ApplicationName)
+		app.Debugf("added client to message id=%s pid=%d name=%s state=%s", client.ID, client.Process.Pid, client.ApplicationName, client.Process.State)
 	}
 	return errors.Wrapf(app.SendTo(addr, msg), "send %s reply", nsm.AddressServerClients)
 }
+
+// capabilitiesArg formats capabilities as an OSC argument.
+// Clients without any capabilities are described with a lone separator,
+// since empty strings can not be sent.
+func capabilitiesArg(caps nsm.Capabilities) string {
+	if len(caps) == 0 {
+		return nsm.CapSep
+	}
+	return caps.String()
+}
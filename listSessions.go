@@ -1,14 +1,17 @@
 package main
 
 import (
+	"encoding/json"
 	"net"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/scgolang/nsm"
 	"github.com/scgolang/osc"
 )
 
-// ListSessions replies with a list of sessions.
+// ListSessions replies with a list of sessions, sorted by name.
 func (app *App) ListSessions(msg osc.Message) error {
 	app.Debug("listing sessions")
 
@@ -31,3 +34,106 @@ func (app *App) sendSessions(addr net.Addr) error {
 
 	return errors.Wrapf(app.SendTo(addr, msg), "send %s reply", nsm.AddressServerSessions)
 }
+
+// AddressSessionList is the address of the request that lists sessions along with their metadata.
+const AddressSessionList = "/gonzo/session/list"
+
+// Optional arguments of a session list request.
+// Filters can be combined, and the tag filter can be repeated to select sessions that have every tag.
+const (
+	sessionListSortPrefix   = "sort="   // e.g. sort=opened
+	sessionListTagPrefix    = "tag="    // e.g. tag=live
+	sessionListOpenedPrefix = "opened=" // e.g. opened=168h selects sessions opened in the last week
+	sessionListJSONArg      = "json"
+)
+
+// noneArg describes a missing description or missing tags, since empty strings can not be sent.
+const noneArg = "-"
+
+// ListSessionInfos replies with the sessions that match a query, along with their metadata.
+// Sessions are sorted by name unless the request asks for another order.
+// Each session is described by its name, its description, its tags separated by commas,
+// the times it was created, last opened and last saved formatted as RFC 3339, and its number of clients.
+// If the request has the json argument then the reply contains a single string,
+// which is the JSON encoding of the list of sessions.
+func (app *App) ListSessionInfos(msg osc.Message) error {
+	var reply osc.Message
+
+	q, asJSON, err := readSessionQuery(msg)
+	if err != nil {
+		reply = ReplyError(AddressSessionList, nsm.ErrGeneral, err.Error())
+		return errors.Wrap(app.SendTo(msg.Sender, reply), "sending reply")
+	}
+	infos, err := app.sessions.Infos(q)
+	if err != nil {
+		reply = ReplyError(AddressSessionList, nsm.ErrGeneral, err.Error())
+		return errors.Wrap(app.SendTo(msg.Sender, reply), "sending reply")
+	}
+	if asJSON {
+		data, err := json.Marshal(infos)
+		if err != nil {
+			return errors.Wrap(err, "encoding sessions")
+		}
+		return errors.Wrapf(app.SendTo(msg.Sender, ReplySuccess(msg.Sender, AddressSessionList, string(data))), "send %s reply", AddressSessionList)
+	}
+	reply = osc.Message{
+		Address: nsm.AddressReply,
+		Arguments: osc.Arguments{
+			osc.String(AddressSessionList),
+			osc.Int(len(infos)),
+		},
+	}
+	for _, info := range infos {
+		reply.Arguments = append(reply.Arguments, []osc.Argument{
+			osc.String(info.Name),
+			osc.String(optionalArg(info.Description)),
+			osc.String(optionalArg(strings.Join(info.Tags, ","))),
+			osc.String(info.Created.Format(time.RFC3339)),
+			osc.String(info.LastOpened.Format(time.RFC3339)),
+			osc.String(info.LastSaved.Format(time.RFC3339)),
+			osc.Int(info.Clients),
+		}...)
+	}
+	return errors.Wrapf(app.SendTo(msg.Sender, reply), "send %s reply", AddressSessionList)
+}
+
+// readSessionQuery reads the optional arguments of a session list request.
+// It returns true if the request has the json argument.
+func readSessionQuery(msg osc.Message) (SessionQuery, bool, error) {
+	var (
+		q      = SessionQuery{Sort: SortByName}
+		asJSON = false
+	)
+	for i, arg := range msg.Arguments {
+		opt, err := arg.ReadString()
+		if err != nil {
+			return SessionQuery{}, false, errors.Wrapf(err, "reading argument %d", i)
+		}
+		switch {
+		case opt == sessionListJSONArg:
+			asJSON = true
+		case strings.HasPrefix(opt, sessionListSortPrefix):
+			q.Sort = strings.TrimPrefix(opt, sessionListSortPrefix)
+		case strings.HasPrefix(opt, sessionListTagPrefix):
+			q.Tags = append(q.Tags, strings.TrimPrefix(opt, sessionListTagPrefix))
+		case strings.HasPrefix(opt, sessionListOpenedPrefix):
+			d, err := time.ParseDuration(strings.TrimPrefix(opt, sessionListOpenedPrefix))
+			if err != nil {
+				return SessionQuery{}, false, errors.Wrap(err, "parsing opened duration")
+			}
+			q.OpenedWithin = d
+		default:
+			return SessionQuery{}, false, errors.Errorf("unknown argument %q", opt)
+		}
+	}
+	return q, asJSON, q.Validate()
+}
+
+// optionalArg formats an optional string as an OSC argument.
+// Empty strings are described with noneArg, since empty strings can not be sent.
+func optionalArg(s string) string {
+	if s == "" {
+		return noneArg
+	}
+	return s
+}
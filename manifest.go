@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/scgolang/nsm"
+)
+
+// manifestFilename is the name of the file in a session's directory
+// that records the clients that belong to the session.
+// The format of the file is the same one that Non Session Manager uses,
+// so sessions can be moved between gonzo and other nsm servers.
+const manifestFilename = "session.nsm"
+
+// manifestSep separates the fields of a manifest entry.
+const manifestSep = ":"
+
+// Prefixes of the optional arguments of an extended add request, e.g.
+//
+//	/nsm/server/add sclang arg=-u arg=57121 env=SC_JACK_DEFAULT_INPUTS=system dir=/home/me/sc restart=on-failure group=1
+//
+// Arguments are passed to the executable in the order they are given.
+const (
+	launchArgPrefix     = "arg="
+	launchDirPrefix     = "dir="
+	launchEnvPrefix     = "env="
+	launchGroupPrefix   = "group="
+	launchRestartPrefix = "restart="
+)
+
+// RestartPolicy determines whether a client is restarted when its process exits
+// without being stopped by gonzo.
+type RestartPolicy string
+
+// Restart policies.
+const (
+	RestartNever     RestartPolicy = "never"
+	RestartOnFailure RestartPolicy = "on-failure"
+	RestartAlways    RestartPolicy = "always"
+)
+
+// Restarts returns true if a client with the restart policy should be restarted
+// after exiting with the provided exit code.
+// The empty policy is the same as RestartNever.
+func (policy RestartPolicy) Restarts(code int) bool {
+	switch policy {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return code != 0
+	default:
+		return false
+	}
+}
+
+// Validate returns an error if the restart policy is not recognized.
+func (policy RestartPolicy) Validate() error {
+	switch policy {
+	case "", RestartNever, RestartOnFailure, RestartAlways:
+		return nil
+	}
+	return errors.Errorf("unrecognized restart policy %q, expected %s, %s or %s", policy, RestartNever, RestartOnFailure, RestartAlways)
+}
+
+// LaunchOptions are options for launching a client that are not part of the manifest format.
+// They are stored in the session's state file.
+type LaunchOptions struct {
+	// Args are passed to the client's executable.
+	Args []string `json:"args,omitempty"`
+
+	// Dir is the client's working directory.
+	// If it is empty the client runs in gonzo's working directory.
+	Dir string `json:"dir,omitempty"`
+
+	// Env is added to the client's environment, with entries of the form KEY=VALUE.
+	Env []string `json:"env,omitempty"`
+
+	// Group is the client's launch group.
+	// Groups are launched in ascending order when a session is opened,
+	// and each group is launched after every client in the previous group has announced itself and opened its project.
+	// Clients are stopped in the reverse order when a session is closed.
+	Group int `json:"group,omitempty"`
+
+	// Restart determines whether the client is restarted when it exits.
+	Restart RestartPolicy `json:"restart,omitempty"`
+}
+
+// ParseLaunchOption parses an optional argument of an extended add request
+// and adds it to the launch options.
+func (opts *LaunchOptions) ParseLaunchOption(arg string) error {
+	switch {
+	case strings.HasPrefix(arg, launchArgPrefix):
+		opts.Args = append(opts.Args, strings.TrimPrefix(arg, launchArgPrefix))
+	case strings.HasPrefix(arg, launchDirPrefix):
+		opts.Dir = strings.TrimPrefix(arg, launchDirPrefix)
+	case strings.HasPrefix(arg, launchEnvPrefix):
+		opts.Env = append(opts.Env, strings.TrimPrefix(arg, launchEnvPrefix))
+	case strings.HasPrefix(arg, launchGroupPrefix):
+		group, err := strconv.Atoi(strings.TrimPrefix(arg, launchGroupPrefix))
+		if err != nil {
+			return errors.Wrap(err, "parsing launch group")
+		}
+		opts.Group = group
+	case strings.HasPrefix(arg, launchRestartPrefix):
+		opts.Restart = RestartPolicy(strings.TrimPrefix(arg, launchRestartPrefix))
+	default:
+		return errors.Errorf("unrecognized argument %q, expected %s, %s, %s, %s or %s", arg, launchArgPrefix, launchDirPrefix, launchEnvPrefix, launchGroupPrefix, launchRestartPrefix)
+	}
+	return nil
+}
+
+// Equal returns true if the launch options are the same as the other launch options, false otherwise.
+func (opts LaunchOptions) Equal(other LaunchOptions) bool {
+	return opts.SameCommand(other) && opts.Group == other.Group && opts.Restart == other.Restart
+}
+
+// SameCommand returns true if the launch options run a client's executable the same way as the other launch options,
+// i.e. with the same arguments, working directory and environment.
+func (opts LaunchOptions) SameCommand(other LaunchOptions) bool {
+	return opts.Dir == other.Dir && equalStrings(opts.Args, other.Args) && equalStrings(opts.Env, other.Env)
+}
+
+// Validate returns an error if the launch options can not be used to launch a client.
+func (opts LaunchOptions) Validate() error {
+	if opts.Dir != "" && !filepath.IsAbs(opts.Dir) {
+		return errors.Errorf("working directory %q is not an absolute path", opts.Dir)
+	}
+	for _, kv := range opts.Env {
+		key := strings.SplitN(kv, "=", 2)[0]
+		if key == "" || !strings.Contains(kv, "=") {
+			return errors.Errorf("environment variable %q does not have the form KEY=VALUE", kv)
+		}
+		if key == nsm.NsmURL {
+			return errors.Errorf("%s is set by gonzo", nsm.NsmURL)
+		}
+	}
+	return opts.Restart.Validate()
+}
+
+// equalStrings returns true if two slices of strings have the same elements in the same order.
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ManifestEntry describes a client that belongs to a session.
+type ManifestEntry struct {
+	Name       string `json:"name"`
+	Executable string `json:"executable"`
+	ID         string `json:"id"`
+
+	LaunchOptions
+}
+
+// Validate returns an error if the entry can not be written to a manifest.
+func (entry ManifestEntry) Validate() error {
+	if entry.Executable == "" {
+		return errors.New("executable must not be empty")
+	}
+	if entry.ID == "" {
+		return errors.New("client ID must not be empty")
+	}
+	for _, field := range []string{entry.Name, entry.Executable, entry.ID} {
+		if strings.Contains(field, manifestSep) || strings.ContainsAny(field, "\r\n") {
+			return errors.Errorf("%q contains a newline or %q", field, manifestSep)
+		}
+	}
+	// The name and ID are used to name the client's directory.
+	if strings.ContainsAny(entry.Name, "/"+string(filepath.Separator)) || entry.Name == "." || entry.Name == ".." {
+		return errors.Errorf("invalid client name %q", entry.Name)
+	}
+	if strings.ContainsRune(entry.ID, filepath.Separator) || entry.ID == "." || entry.ID == ".." {
+		return errors.Errorf("invalid client ID %q", entry.ID)
+	}
+	return errors.Wrap(entry.LaunchOptions.Validate(), "validating launch options")
+}
+
+// Manifest is the list of clients that belong to a session.
+type Manifest []ManifestEntry
+
+// ReadManifest reads a manifest from the provided io.Reader.
+// Each line of the manifest has the form name:executable:id
+// Note that launch options are not part of the manifest.
+func ReadManifest(r io.Reader) (Manifest, error) {
+	var (
+		m  = Manifest{}
+		sc = bufio.NewScanner(r)
+	)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if len(line) == 0 {
+			continue
+		}
+		parts := strings.Split(line, manifestSep)
+		if len(parts) != 3 {
+			return nil, errors.Errorf("malformed manifest line %q", line)
+		}
+		m = append(m, ManifestEntry{
+			Name:       parts[0],
+			Executable: parts[1],
+			ID:         parts[2],
+		})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, errors.Wrap(err, "scanning manifest")
+	}
+	return m, nil
+}
+
+// WriteTo writes the manifest to an io.Writer.
+func (m Manifest) WriteTo(w io.Writer) (int64, error) {
+	var written int64
+	for _, entry := range m {
+		n, err := fmt.Fprintln(w, strings.Join([]string{entry.Name, entry.Executable, entry.ID}, manifestSep))
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// Groups returns the manifest's entries grouped by launch group, with the groups in launch order.
+// Entries are kept in manifest order within each group.
+func (m Manifest) Groups() []Manifest {
+	sorted := make(Manifest, len(m))
+	copy(sorted, m)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Group < sorted[j].Group
+	})
+	groups := []Manifest{}
+	for i, entry := range sorted {
+		if i == 0 || entry.Group != sorted[i-1].Group {
+			groups = append(groups, Manifest{})
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], entry)
+	}
+	return groups
+}
+
+// Contains returns true if the manifest contains a client with the provided ID.
+func (m Manifest) Contains(clientID string) bool {
+	for _, entry := range m {
+		if entry.ID == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+// Without returns a copy of the manifest without the client that has the provided ID.
+func (m Manifest) Without(clientID string) Manifest {
+	without := Manifest{}
+	for _, entry := range m {
+		if entry.ID != clientID {
+			without = append(without, entry)
+		}
+	}
+	return without
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestManifestRoundTrip(t *testing.T) {
+	m := Manifest{
+		{Name: "SuperCollider", Executable: "sclang", ID: "nAAAA"},
+		{Name: "Carla", Executable: "/usr/bin/carla", ID: "nBBBB"},
+		{Name: "", Executable: "fake", ID: "nCCCC"},
+	}
+	buf := &bytes.Buffer{}
+
+	n, err := m.WriteTo(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := int64(buf.Len()), n; expected != got {
+		t.Fatalf("expected %d bytes written, got %d", expected, got)
+	}
+	if expected, got := "SuperCollider:sclang:nAAAA\nCarla:/usr/bin/carla:nBBBB\n:fake:nCCCC\n", buf.String(); expected != got {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+	read, err := ReadManifest(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := len(m), len(read); expected != got {
+		t.Fatalf("expected %d entries, got %d", expected, got)
+	}
+	for i, entry := range read {
+		if expected, got := m[i], entry; expected.Name != got.Name || expected.Executable != got.Executable || expected.ID != got.ID {
+			t.Fatalf("expected %+v, got %+v", expected, got)
+		}
+	}
+}
+
+func TestReadManifest(t *testing.T) {
+	for _, testcase := range []struct {
+		name     string
+		contents string
+		entries  int
+	}{
+		{"empty", "", 0},
+		{"blank lines", "\n  \nfake:fake:nAAAA\n\n", 1},
+		{"surrounding space", "  fake:fake:nAAAA  \r\n", 1},
+		{"too few fields", "fake:nAAAA\n", -1},
+		{"too many fields", "fake:fake:nAAAA:extra\n", -1},
+		{"colon in a field", "fake:/opt/a:b/fake:nAAAA\n", -1},
+		{"one malformed line", "fake:fake:nAAAA\nmalformed\n", -1},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			m, err := ReadManifest(strings.NewReader(testcase.contents))
+			if testcase.entries < 0 {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", m)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected, got := testcase.entries, len(m); expected != got {
+				t.Fatalf("expected %d entries, got %d", expected, got)
+			}
+		})
+	}
+}
+
+func TestManifestEntryValidate(t *testing.T) {
+	for _, testcase := range []struct {
+		name  string
+		entry ManifestEntry
+		valid bool
+	}{
+		{"valid", ManifestEntry{Name: "fake", Executable: "/usr/bin/fake", ID: "nAAAA"}, true},
+		{"no name", ManifestEntry{Executable: "fake", ID: "nAAAA"}, true},
+		{"no executable", ManifestEntry{Name: "fake", ID: "nAAAA"}, false},
+		{"no ID", ManifestEntry{Name: "fake", Executable: "fake"}, false},
+		{"colon in the name", ManifestEntry{Name: "fake:1", Executable: "fake", ID: "nAAAA"}, false},
+		{"colon in the executable", ManifestEntry{Name: "fake", Executable: "C:fake", ID: "nAAAA"}, false},
+		{"colon in the ID", ManifestEntry{Name: "fake", Executable: "fake", ID: "n:AAA"}, false},
+		{"newline in the name", ManifestEntry{Name: "fake\nevil:evil:nBBBB", Executable: "fake", ID: "nAAAA"}, false},
+		{"slash in the name", ManifestEntry{Name: "../fake", Executable: "fake", ID: "nAAAA"}, false},
+		{"dot dot name", ManifestEntry{Name: "..", Executable: "fake", ID: "nAAAA"}, false},
+		{"slash in the ID", ManifestEntry{Name: "fake", Executable: "fake", ID: "n/AAA"}, false},
+		{"dot dot ID", ManifestEntry{Name: "fake", Executable: "fake", ID: ".."}, false},
+		{"dot ID", ManifestEntry{Name: "fake", Executable: "fake", ID: "."}, false},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			err := testcase.entry.Validate()
+			if testcase.valid && err != nil {
+				t.Fatalf("expected %+v to be valid, got %s", testcase.entry, err)
+			}
+			if !testcase.valid && err == nil {
+				t.Fatalf("expected %+v to be invalid", testcase.entry)
+			}
+		})
+	}
+}
+
+func TestParseLaunchOption(t *testing.T) {
+	var (
+		opts LaunchOptions
+		args = []string{
+			"arg=-u",
+			"env=SC_JACK_DEFAULT_INPUTS=system",
+			"arg=57121",
+			"dir=/home/me/sc",
+			"group=-2",
+			"restart=on-failure",
+		}
+	)
+	for _, arg := range args {
+		if err := opts.ParseLaunchOption(arg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := LaunchOptions{
+		Args:    []string{"-u", "57121"},
+		Dir:     "/home/me/sc",
+		Env:     []string{"SC_JACK_DEFAULT_INPUTS=system"},
+		Group:   -2,
+		Restart: RestartOnFailure,
+	}
+	if !expected.Equal(opts) {
+		t.Fatalf("expected %+v, got %+v", expected, opts)
+	}
+	for _, arg := range []string{
+		"group=",
+		"group=first",
+		"group=1.5",
+		"args=-u",
+		"-u",
+		"",
+	} {
+		if err := opts.ParseLaunchOption(arg); err == nil {
+			t.Fatalf("expected an error parsing %q", arg)
+		}
+	}
+}
+
+func TestLaunchOptionsValidate(t *testing.T) {
+	for _, testcase := range []struct {
+		name  string
+		opts  LaunchOptions
+		valid bool
+	}{
+		{"empty", LaunchOptions{}, true},
+		{"absolute dir", LaunchOptions{Dir: "/home/me/sc"}, true},
+		{"relative dir", LaunchOptions{Dir: "sc"}, false},
+		{"dot dir", LaunchOptions{Dir: "."}, false},
+		{"env", LaunchOptions{Env: []string{"FOO=bar", "EMPTY="}}, true},
+		{"env without equals", LaunchOptions{Env: []string{"FOO"}}, false},
+		{"env without a key", LaunchOptions{Env: []string{"=bar"}}, false},
+		{"NSM_URL", LaunchOptions{Env: []string{"NSM_URL=osc.udp://localhost:1234/"}}, false},
+		{"restart policy", LaunchOptions{Restart: RestartAlways}, true},
+		{"bad restart policy", LaunchOptions{Restart: "sometimes"}, false},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			err := testcase.opts.Validate()
+			if testcase.valid && err != nil {
+				t.Fatalf("expected %+v to be valid, got %s", testcase.opts, err)
+			}
+			if !testcase.valid && err == nil {
+				t.Fatalf("expected %+v to be invalid", testcase.opts)
+			}
+		})
+	}
+}
+
+func TestManifestGroups(t *testing.T) {
+	m := Manifest{
+		{Executable: "a", ID: "n1", LaunchOptions: LaunchOptions{Group: 2}},
+		{Executable: "b", ID: "n2"},
+		{Executable: "c", ID: "n3", LaunchOptions: LaunchOptions{Group: -1}},
+		{Executable: "d", ID: "n4", LaunchOptions: LaunchOptions{Group: 2}},
+		{Executable: "e", ID: "n5"},
+		{Executable: "f", ID: "n6", LaunchOptions: LaunchOptions{Group: 2}},
+	}
+	groups := m.Groups()
+
+	if expected, got := "[[n3] [n2 n5] [n1 n4 n6]]", fmt.Sprint(manifestIDs(groups)); expected != got {
+		t.Fatalf("expected groups %s, got %s", expected, got)
+	}
+	if expected, got := "n1", m[0].ID; expected != got {
+		t.Fatalf("expected the manifest to be left in order, got %s first", got)
+	}
+	if expected, got := 0, len(Manifest{}.Groups()); expected != got {
+		t.Fatalf("expected %d groups, got %d", expected, got)
+	}
+}
+
+// manifestIDs returns the client ID's of a list of manifests.
+func manifestIDs(groups []Manifest) [][]string {
+	ids := [][]string{}
+	for _, group := range groups {
+		groupIDs := []string{}
+		for _, entry := range group {
+			groupIDs = append(groupIDs, entry.ID)
+		}
+		ids = append(ids, groupIDs)
+	}
+	return ids
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// metaFilename is the name of the file in a session's directory that records
+// the session's description, tags, and when it was created, last opened and last saved.
+const metaFilename = "gonzo-meta.json"
+
+// Orders that sessions can be listed in.
+const (
+	SortByName    = "name"
+	SortByOpened  = "opened"
+	SortBySaved   = "saved"
+	SortByCreated = "created"
+)
+
+// SessionMeta describes a session.
+// Times are zero if the session has never been opened or saved,
+// and the created time is zero for sessions that were created before gonzo kept metadata.
+type SessionMeta struct {
+	Description string    `json:"description,omitempty"`
+	Tags        []string  `json:"tags,omitempty"`
+	Created     time.Time `json:"created"`
+	LastOpened  time.Time `json:"last_opened"`
+	LastSaved   time.Time `json:"last_saved"`
+}
+
+// ReadSessionMeta reads session metadata from the provided io.Reader.
+func ReadSessionMeta(r io.Reader) (SessionMeta, error) {
+	meta := SessionMeta{}
+	if err := json.NewDecoder(r).Decode(&meta); err != nil {
+		return SessionMeta{}, errors.Wrap(err, "decoding session metadata")
+	}
+	return meta, nil
+}
+
+// WriteTo writes the session metadata to an io.Writer.
+func (meta SessionMeta) WriteTo(w io.Writer) (int64, error) {
+	buf, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return 0, errors.Wrap(err, "encoding session metadata")
+	}
+	n, err := w.Write(append(buf, '\n'))
+	return int64(n), err
+}
+
+// HasTag returns true if the session has the provided tag, false otherwise.
+func (meta SessionMeta) HasTag(tag string) bool {
+	for _, t := range meta.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// SessionInfo describes a session in a list of sessions.
+// The number of clients is the number of entries in the session's manifest.
+type SessionInfo struct {
+	Name string `json:"name"`
+	SessionMeta
+	Clients int `json:"clients"`
+}
+
+// SessionQuery selects and orders sessions in a list of sessions.
+type SessionQuery struct {
+	// Sort is one of SortByName, SortByOpened, SortBySaved or SortByCreated.
+	// Sessions are sorted by name in ascending order, and by time with the most recent first.
+	Sort string
+
+	// Tags selects the sessions that have all of the tags.
+	Tags []string
+
+	// OpenedWithin selects the sessions that were last opened within the duration, if it is not zero.
+	OpenedWithin time.Duration
+}
+
+// Validate returns an error if the query has an unknown sort order or a negative duration.
+func (q SessionQuery) Validate() error {
+	switch q.Sort {
+	case "", SortByName, SortByOpened, SortBySaved, SortByCreated:
+	default:
+		return errors.Errorf("unknown sort order %q, expected %s, %s, %s or %s", q.Sort, SortByName, SortByOpened, SortBySaved, SortByCreated)
+	}
+	if q.OpenedWithin < 0 {
+		return errors.Errorf("negative duration %s", q.OpenedWithin)
+	}
+	return nil
+}
+
+// Matches returns true if the query selects the session, false otherwise.
+func (q SessionQuery) Matches(info SessionInfo, now time.Time) bool {
+	for _, tag := range q.Tags {
+		if !info.HasTag(tag) {
+			return false
+		}
+	}
+	if q.OpenedWithin > 0 && (info.LastOpened.IsZero() || now.Sub(info.LastOpened) > q.OpenedWithin) {
+		return false
+	}
+	return true
+}
+
+// Infos returns the sessions that the query selects, in the query's order.
+func (s *Sessions) Infos(q SessionQuery) ([]SessionInfo, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	if err := s.Read(); err != nil {
+		return nil, errors.Wrap(err, "reading sessions")
+	}
+	var (
+		infos = []SessionInfo{}
+		now   = time.Now()
+	)
+	s.Mu.RLock()
+	for _, sesh := range s.M {
+		info := SessionInfo{
+			Name:        sesh.Name(),
+			SessionMeta: sesh.Meta(),
+			Clients:     len(sesh.Manifest()),
+		}
+		if q.Matches(info, now) {
+			infos = append(infos, info)
+		}
+	}
+	s.Mu.RUnlock()
+
+	sort.Slice(infos, func(i, j int) bool {
+		var a, b time.Time
+
+		switch q.Sort {
+		case SortByOpened:
+			a, b = infos[i].LastOpened, infos[j].LastOpened
+		case SortBySaved:
+			a, b = infos[i].LastSaved, infos[j].LastSaved
+		case SortByCreated:
+			a, b = infos[i].Created, infos[j].Created
+		}
+		if !a.Equal(b) {
+			return a.After(b)
+		}
+		return infos[i].Name < infos[j].Name
+	})
+	return infos, nil
+}
+
+// Meta returns the session's metadata.
+func (s *Session) Meta() SessionMeta {
+	s.metaMutex.RLock()
+	defer s.metaMutex.RUnlock()
+
+	meta := s.meta
+	meta.Tags = append([]string(nil), s.meta.Tags...)
+	return meta
+}
+
+// SetDescription sets the session's description.
+func (s *Session) SetDescription(description string) error {
+	return s.updateMeta(func(meta *SessionMeta) {
+		meta.Description = description
+	})
+}
+
+// SetTags replaces the session's tags.
+// Tags are sorted and duplicates are removed.
+func (s *Session) SetTags(tags []string) error {
+	for _, tag := range tags {
+		if tag == "" || strings.ContainsAny(tag, ", \t\r\n") {
+			return errors.Errorf("invalid tag %q", tag)
+		}
+	}
+	set := map[string]bool{}
+	for _, tag := range tags {
+		set[tag] = true
+	}
+	sorted := make([]string, 0, len(set))
+	for tag := range set {
+		sorted = append(sorted, tag)
+	}
+	sort.Strings(sorted)
+
+	return s.updateMeta(func(meta *SessionMeta) {
+		meta.Tags = sorted
+	})
+}
+
+// created records that the session was created now.
+// The description and tags are kept, which matters for sessions that are copied from other sessions or templates.
+func (s *Session) created() error {
+	return s.updateMeta(func(meta *SessionMeta) {
+		meta.Created = time.Now()
+		meta.LastOpened = time.Time{}
+		meta.LastSaved = time.Time{}
+	})
+}
+
+// opened records that the session was opened now.
+func (s *Session) opened() error {
+	return s.updateMeta(func(meta *SessionMeta) {
+		meta.LastOpened = time.Now()
+	})
+}
+
+// saved records that the session was saved now.
+func (s *Session) saved() error {
+	return s.updateMeta(func(meta *SessionMeta) {
+		meta.LastSaved = time.Now()
+	})
+}
+
+// updateMeta changes the session's metadata and writes it to disk.
+func (s *Session) updateMeta(update func(meta *SessionMeta)) error {
+	s.metaMutex.Lock()
+	defer s.metaMutex.Unlock()
+
+	update(&s.meta)
+
+	return writeFileAtomic(filepath.Join(s.Path, metaFilename), s.meta)
+}
+
+// readMeta reads the session's metadata from disk.
+// A session without a metadata file has no metadata.
+func (s *Session) readMeta() error {
+	f := filepath.Join(s.Path, metaFilename)
+	fd, err := os.Open(f)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "opening %s", f)
+	}
+	defer func() { _ = fd.Close() }() // Best effort.
+
+	meta, err := ReadSessionMeta(fd)
+	if err != nil {
+		return errors.Wrapf(err, "reading %s", f)
+	}
+	s.metaMutex.Lock()
+	s.meta = meta
+	s.metaMutex.Unlock()
+
+	return nil
+}
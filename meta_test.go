@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSessionsInfos(t *testing.T) {
+	var (
+		s     = newTestSessions(t)
+		now   = time.Now()
+		metas = map[string]SessionMeta{
+			"a": {Tags: []string{"live"}, Created: now.Add(-3 * time.Hour), LastOpened: now.Add(-2 * time.Hour), LastSaved: now.Add(-time.Hour)},
+			"b": {Tags: []string{"live", "synth"}, Created: now.Add(-time.Hour), LastSaved: now.Add(-3 * time.Hour)},
+			"c": {Tags: []string{"synth"}, Created: now.Add(-2 * time.Hour), LastOpened: now.Add(-time.Minute)},
+			"d": {},
+		}
+	)
+	for name, meta := range metas {
+		if err := s.New(name); err != nil {
+			t.Fatal(err)
+		}
+		sesh, err := s.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		meta := meta
+		if err := sesh.updateMeta(func(m *SessionMeta) { *m = meta }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, testcase := range []struct {
+		name     string
+		query    SessionQuery
+		expected string
+	}{
+		{"all", SessionQuery{}, "[a b c d]"},
+		{"by name", SessionQuery{Sort: SortByName}, "[a b c d]"},
+		{"by opened", SessionQuery{Sort: SortByOpened}, "[c a b d]"},
+		{"by saved", SessionQuery{Sort: SortBySaved}, "[a b c d]"},
+		{"by created", SessionQuery{Sort: SortByCreated}, "[b c a d]"},
+		{"one tag", SessionQuery{Tags: []string{"live"}}, "[a b]"},
+		{"every tag", SessionQuery{Tags: []string{"live", "synth"}}, "[b]"},
+		{"unknown tag", SessionQuery{Tags: []string{"studio"}}, "[]"},
+		{"tag and sort", SessionQuery{Tags: []string{"synth"}, Sort: SortByCreated}, "[b c]"},
+		{"opened within", SessionQuery{OpenedWithin: time.Hour, Sort: SortByOpened}, "[c]"},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			infos, err := s.Infos(testcase.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			names := []string{}
+			for _, info := range infos {
+				names = append(names, info.Name)
+			}
+			if expected, got := testcase.expected, fmt.Sprint(names); expected != got {
+				t.Fatalf("expected %s, got %s", expected, got)
+			}
+		})
+	}
+	for _, q := range []SessionQuery{
+		{Sort: "size"},
+		{OpenedWithin: -time.Hour},
+	} {
+		if _, err := s.Infos(q); err == nil {
+			t.Fatalf("expected an error for query %+v", q)
+		}
+	}
+}
@@ -2,26 +2,112 @@ package main
 
 import (
 	"fmt"
+	"strings"
 
+	"github.com/pkg/errors"
 	"github.com/scgolang/nsm"
 	"github.com/scgolang/osc"
 )
 
+// templateArgPrefix is the prefix of the optional argument of a new request that names a template,
+// e.g. template=band
+const templateArgPrefix = "template="
+
 // NewSession creates a new session, and makes the new session the current session.
+// The current session is saved and closed first.
+// If the current session still has unsaved changes after saving then the new session
+// is only created if the force argument is provided.
+// If a template argument is provided then the new session is created from the template
+// and its clients are launched.
 func (app *App) NewSession(msg osc.Message) (string, nsm.Error) {
-	const code = nsm.ErrNoSessionOpen
+	app.sessionMutex.Lock()
+	defer app.sessionMutex.Unlock()
+
+	const code = nsm.ErrCreateFailed
 
-	if expected, got := 1, len(msg.Arguments); expected != got {
-		return "", nsm.NewError(code, fmt.Sprintf("expected %d arguments, got %d", expected, got))
+	if min, max, got := 1, 3, len(msg.Arguments); got < min || got > max {
+		return "", nsm.NewError(code, fmt.Sprintf("expected between %d and %d arguments, got %d", min, max, got))
 	}
 	name, err := msg.Arguments[0].ReadString()
 	if err != nil {
 		return "", nsm.NewError(code, "reading string from message")
 	}
+	template, force, err := readNewOptions(msg)
+	if err != nil {
+		return "", nsm.NewError(code, err.Error())
+	}
+	if template != "" {
+		return app.newSessionFromTemplate(name, template, force)
+	}
 	app.Debugf("creating a new session named %s", name)
 
+	// Keep the current session open if the new session can not be created.
+	if err := app.sessions.CheckNew(name); err != nil {
+		return "", nsm.NewError(code, err.Error())
+	}
+	if err := app.closeCurrentSession(nil, force); err != nil {
+		return "", err
+	}
 	if err := app.sessions.New(name); err != nil {
-		return "", nsm.NewError(code, "creating new session")
+		return "", nsm.NewError(code, errors.Wrap(err, "creating new session").Error())
 	}
+	if err := app.sessions.Open(name); err != nil {
+		return "", nsm.NewError(code, err.Error())
+	}
+	sesh, err := app.sessions.Current()
+	if err != nil {
+		return "", nsm.NewError(code, err.Error())
+	}
+	app.sessionLoaded(sesh)
+
 	return "created new session " + name, nil
 }
+
+// newSessionFromTemplate creates a new session from a template, makes it the current session,
+// and launches its clients.
+func (app *App) newSessionFromTemplate(name, template string, force bool) (string, nsm.Error) {
+	const code = nsm.ErrCreateFailed
+
+	app.Debugf("creating a new session named %s from template %s", name, template)
+
+	// Keep the current session open if the new session can not be created.
+	if err := app.sessions.checkNewFromTemplate(name, template); err != nil {
+		return "", nsm.NewError(code, err.Error())
+	}
+	if err := app.closeCurrentSession(nil, force); err != nil {
+		return "", err
+	}
+	if err := app.sessions.NewFromTemplate(name, template); err != nil {
+		return "", nsm.NewError(code, err.Error())
+	}
+	if err := app.sessions.Open(name); err != nil {
+		return "", nsm.NewError(code, err.Error())
+	}
+	sesh, err := app.sessions.Current()
+	if err != nil {
+		return "", nsm.NewError(code, err.Error())
+	}
+	if failed := app.launchSession(sesh); len(failed) > 0 {
+		return "created new session " + name + " from template " + template + " but these clients failed: " + strings.Join(failed, ", "), nil
+	}
+	return "created new session " + name + " from template " + template, nil
+}
+
+// readNewOptions reads the optional template and force arguments that follow the name in a new request.
+func readNewOptions(msg osc.Message) (template string, force bool, err error) {
+	for i, arg := range msg.Arguments[1:] {
+		opt, err := arg.ReadString()
+		if err != nil {
+			return "", false, errors.Wrapf(err, "reading argument %d", i+1)
+		}
+		switch {
+		case opt == forceArg:
+			force = true
+		case strings.HasPrefix(opt, templateArgPrefix):
+			template = strings.TrimPrefix(opt, templateArgPrefix)
+		default:
+			return "", false, errors.Errorf("expected %q or %s<name>, got %q", forceArg, templateArgPrefix, opt)
+		}
+	}
+	return template, force, nil
+}
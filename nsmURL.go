@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net"
+	"os"
+)
+
+// nsmURLScheme is the scheme of the URL that clients use to reach the server.
+const nsmURLScheme = "osc.udp://"
+
+// NsmURL returns the URL that clients use to reach a server listening on the provided address.
+// The URL has the form osc.udp://host:port/ which is what liblo-based clients expect.
+// If the server is listening on all interfaces the host is the machine's hostname,
+// or localhost if the hostname can not be resolved.
+func NsmURL(addr net.Addr) string {
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nsmURLScheme + addr.String() + "/"
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		host = reachableHostname()
+	}
+	return nsmURLScheme + net.JoinHostPort(host, port) + "/"
+}
+
+// reachableHostname returns the machine's hostname if it can be resolved, otherwise localhost.
+func reachableHostname() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "localhost"
+	}
+	if _, err := net.LookupHost(hostname); err != nil {
+		return "localhost"
+	}
+	return hostname
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/scgolang/nsm"
+	"github.com/scgolang/osc"
+)
+
+// openTimeout is how long we wait for a client to reply to an open message.
+const openTimeout = 30 * time.Second
+
+// OpenSession saves and closes the current session, makes the named session the current session,
+// and relaunches all of its clients.
+// Running clients that can switch sessions are not relaunched if the named session has a client
+// with the same executable, instead they are told to open their project in the named session.
+// If the current session still has unsaved changes after saving then the named session
+// is only opened if the force argument is provided.
+// The reply is sent after every client has replied to the open message or timed out.
+func (app *App) OpenSession(msg osc.Message) (string, nsm.Error) {
+	app.sessionMutex.Lock()
+	defer app.sessionMutex.Unlock()
+
+	const code = nsm.ErrNoSuchFile
+
+	if min, max, got := 1, 2, len(msg.Arguments); got < min || got > max {
+		return "", nsm.NewError(code, fmt.Sprintf("expected %d or %d arguments, got %d", min, max, got))
+	}
+	name, err := msg.Arguments[0].ReadString()
+	if err != nil {
+		return "", nsm.NewError(code, "reading string from message")
+	}
+	force, err := ReadForce(msg, 1)
+	if err != nil {
+		return "", nsm.NewError(code, err.Error())
+	}
+	app.Debugf("opening session named %s", name)
+
+	next, err := app.sessions.Get(name)
+	if err != nil {
+		return "", nsm.NewError(code, err.Error())
+	}
+	if err := app.closeCurrentSession(next, force); err != nil {
+		return "", err
+	}
+	if err := app.sessions.Open(name); err != nil {
+		return "", nsm.NewError(code, err.Error())
+	}
+	sesh, err := app.sessions.Current()
+	if err != nil {
+		return "", nsm.NewError(code, err.Error())
+	}
+	if failed := app.launchSession(sesh); len(failed) > 0 {
+		return "opened session " + name + " but these clients failed: " + strings.Join(failed, ", "), nil
+	}
+	return "opened session " + name, nil
+}
+
+// launchSession launches all the clients in a session and tells them to open their projects.
+// Clients are launched one launch group at a time, and each group is launched
+// after every client in the previous group has opened its project or failed.
+// Clients that are already running, because they switched from the previous session, are not launched
+// but are still told to open their projects along with the rest of their group.
+// Once every client has opened its project or failed, the clients are told that the session is loaded.
+// It returns the IDs of the clients that failed to launch or open.
+func (app *App) launchSession(sesh *Session) []string {
+	clients := sesh.Clients()
+	failed := []string{}
+
+	for _, group := range sesh.Manifest().Groups() {
+		running := map[string]*Client{}
+		for _, entry := range group {
+			if client, ok := clients[entry.ID]; ok {
+				running[entry.ID] = client
+			}
+		}
+		pids, err := sesh.Open(group, app.Conn, app)
+		if err != nil {
+			app.Debugf("launching clients: %s", err)
+		}
+		for _, entry := range group {
+			_, launched := pids[entry.ID]
+			_, switched := running[entry.ID]
+			if !launched && !switched {
+				failed = append(failed, entry.ID)
+			}
+		}
+		failed = append(failed, app.openClients(sesh, pids, running)...)
+	}
+	app.sessionLoaded(sesh)
+
+	return failed
+}
+
+// sessionLoaded tells every announced client in a session, and every controller, that the session is loaded.
+func (app *App) sessionLoaded(sesh *Session) {
+	for _, client := range sesh.Clients() {
+		if err := app.SendTo(client.Addr, osc.Message{Address: nsm.AddressClientSessionIsLoaded}); err != nil {
+			app.Debugf("sending %s to client %s: %s", nsm.AddressClientSessionIsLoaded, client.ID, err)
+		}
+	}
+	app.Notify(osc.Message{
+		Address: AddressGUISessionLoaded,
+		Arguments: osc.Arguments{
+			osc.String(sesh.Name()),
+		},
+	})
+}
+
+// openClients waits for launched clients to announce themselves and open their projects,
+// and tells clients that are already running to open their projects.
+// It returns the IDs of the clients that failed to open.
+func (app *App) openClients(sesh *Session, pids map[string]Pid, running map[string]*Client) []string {
+	var (
+		failed      = []string{}
+		failedMutex sync.Mutex
+		wg          sync.WaitGroup
+	)
+	fail := func(clientID string, err error) {
+		if err == nil {
+			return
+		}
+		app.Debugf("opening client %s: %s", clientID, err)
+		failedMutex.Lock()
+		failed = append(failed, clientID)
+		failedMutex.Unlock()
+	}
+	for clientID, pid := range pids {
+		wg.Add(1)
+		go func(clientID string, pid Pid) {
+			defer wg.Done()
+			fail(clientID, app.openClient(sesh, clientID, pid))
+		}(clientID, pid)
+	}
+	for clientID, client := range running {
+		wg.Add(1)
+		go func(clientID string, client *Client) {
+			defer wg.Done()
+			_, err := app.sendOpen(sesh, clientID, client)
+			fail(clientID, err)
+		}(clientID, client)
+	}
+	wg.Wait()
+	return failed
+}
+
+// openClient waits for a launched client to announce itself then tells it to open its project.
+func (app *App) openClient(sesh *Session, clientID string, pid Pid) error {
+	client, err := sesh.WaitAnnounce(pid, app.LaunchTimeout)
+	if err != nil {
+		return errors.Wrap(err, "waiting for announcement")
+	}
+	_, err = app.sendOpen(sesh, clientID, client)
+	return err
+}
+
+// sendOpen tells an announced client to open its project, and records how the client replied.
+// It returns the message the client replied with.
+// If the client replied with an error then an nsm.Error is returned.
+func (app *App) sendOpen(sesh *Session, clientID string, client *Client) (string, error) {
+	entry, ok := sesh.Entry(clientID)
+	if !ok {
+		return "", errors.New("client is not in the session's manifest: " + clientID)
+	}
+	open := osc.Message{
+		Address: nsm.AddressClientOpen,
+		Arguments: osc.Arguments{
+			osc.String(sesh.ClientPath(entry)),
+			osc.String(sesh.Name()),
+			osc.String(clientID),
+		},
+	}
+	reply, err := app.Request(client.Addr, open, openTimeout)
+	if err != nil {
+		if err := sesh.SetOpenResult(clientID, false, err.Error()); err != nil {
+			app.Debugf("recording open result of client %s: %s", clientID, err)
+		}
+		return "", errors.Wrap(err, "requesting "+nsm.AddressClientOpen)
+	}
+	result, err := ReadReply(reply)
+	if err != nil {
+		return "", errors.Wrap(err, "reading reply to "+nsm.AddressClientOpen)
+	}
+	if err := sesh.SetOpenResult(clientID, true, result); err != nil {
+		app.Debugf("recording open result of client %s: %s", clientID, err)
+	}
+	return result, errors.Wrap(app.restoreGUI(sesh, clientID, client), "restoring optional GUI")
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/scgolang/nsm"
+	"github.com/scgolang/osc"
+)
+
+// Addresses used to show and hide the optional GUI of individual clients.
+const (
+	AddressClientHideGUI = "/nsm/gui/client/hide_optional_gui"
+	AddressClientShowGUI = "/nsm/gui/client/show_optional_gui"
+)
+
+// HideClientGUI tells a client in the current session to hide its optional GUI.
+func (app *App) HideClientGUI(msg osc.Message) (string, nsm.Error) {
+	return app.showClientGUI(msg, false)
+}
+
+// ShowClientGUI tells a client in the current session to show its optional GUI.
+func (app *App) ShowClientGUI(msg osc.Message) (string, nsm.Error) {
+	return app.showClientGUI(msg, true)
+}
+
+// showClientGUI tells the client named in a message to show or hide its optional GUI.
+// The client's GUI visibility is updated when the client reports that it is showing or hiding its GUI.
+func (app *App) showClientGUI(msg osc.Message, show bool) (string, nsm.Error) {
+	const code = nsm.ErrGeneral
+
+	if expected, got := 1, len(msg.Arguments); expected != got {
+		return "", nsm.NewError(code, fmt.Sprintf("expected %d arguments, got %d", expected, got))
+	}
+	clientID, err := msg.Arguments[0].ReadString()
+	if err != nil {
+		return "", nsm.NewError(code, "reading string from message")
+	}
+	currentSession, err := app.sessions.Current()
+	if err != nil {
+		return "", nsm.NewError(nsm.ErrNoSessionOpen, err.Error())
+	}
+	client, err := currentSession.Client(clientID)
+	if err != nil {
+		return "", nsm.NewError(nsm.ErrNoSuchFile, err.Error())
+	}
+	if !client.HasCapability(nsm.CapGUI) {
+		return "", nsm.NewError(code, "client "+clientID+" does not have the "+string(nsm.CapGUI)+" capability")
+	}
+	if err := app.sendShowGUI(client, show); err != nil {
+		return "", nsm.NewError(code, err.Error())
+	}
+	if show {
+		return "showing optional GUI of client " + clientID, nil
+	}
+	return "hiding optional GUI of client " + clientID, nil
+}
+
+// ClientGUIHidden handles clients telling us they have hidden their optional GUI.
+func (app *App) ClientGUIHidden(msg osc.Message) error {
+	return app.setGUIVisible(msg, false)
+}
+
+// ClientGUIShowing handles clients telling us they are showing their optional GUI.
+func (app *App) ClientGUIShowing(msg osc.Message) error {
+	return app.setGUIVisible(msg, true)
+}
+
+// setGUIVisible records the GUI visibility of the client that sent a message
+// and relays it to every controller.
+func (app *App) setGUIVisible(msg osc.Message, visible bool) error {
+	currentSession, err := app.sessions.Current()
+	if err != nil {
+		return err
+	}
+	client, err := currentSession.SetGUIVisible(msg.Sender, visible)
+	if err != nil {
+		return err
+	}
+	app.Notify(osc.Message{
+		Address: AddressGUIClientGUIVisible,
+		Arguments: osc.Arguments{
+			osc.String(client.ID),
+			osc.Bool(visible),
+		},
+	})
+	return nil
+}
+
+// restoreGUI tells a client that has just opened its project to show or hide its optional GUI,
+// according to the visibility that was last reported in the session.
+func (app *App) restoreGUI(sesh *Session, clientID string, client *Client) error {
+	if !client.HasCapability(nsm.CapGUI) {
+		return nil
+	}
+	visible, known := sesh.GUIVisible(clientID)
+	if !known {
+		return nil
+	}
+	return app.sendShowGUI(*client, visible)
+}
+
+// sendShowGUI tells a client to show or hide its optional GUI.
+func (app *App) sendShowGUI(client Client, show bool) error {
+	addr := nsm.AddressClientHideOptionalGUI
+	if show {
+		addr = nsm.AddressClientShowOptionalGUI
+	}
+	return errors.Wrapf(app.SendTo(client.Addr, osc.Message{Address: addr}), "sending %s", addr)
+}
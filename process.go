@@ -0,0 +1,266 @@
+package main
+
+import (
+	"io"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/scgolang/exec"
+)
+
+// process is a client process that was started by a session.
+type process struct {
+	*exec.Cmd
+
+	stdout io.ReadCloser
+	stderr io.ReadCloser
+
+	// started is when the process was started.
+	started time.Time
+
+	// stdoutLog and stderrLog are the files where the process's output is piped.
+	stdoutLog *logFile
+	stderrLog *logFile
+
+	// session is the session that owns the process and clientID is the ID of its client in that session.
+	// A running process can be moved to another session if its client can switch sessions.
+	session    *Session
+	clientID   string
+	ownerMutex sync.Mutex
+
+	// exited is closed after the process has exited, its output has been piped,
+	// and it has been removed from the session that owns it.
+	exited chan struct{}
+	piped  sync.WaitGroup
+	err    error
+
+	// stopped is true if the process was signalled by gonzo, as opposed to exiting on its own.
+	stopped      bool
+	stoppedMutex sync.Mutex
+}
+
+// outputGrace is how long the output of a process is piped after the process has exited.
+// Children of the process can keep its stdout and stderr open after it has exited,
+// e.g. sclang starting scsynth, so the pipes are closed once the grace period is over.
+const outputGrace = 2 * time.Second
+
+// startProcess starts a command in its own process group with pipes connected to its stdout and stderr.
+// The pipes are created here rather than with StdoutPipe and StderrPipe,
+// since exec.Cmd would otherwise close them as soon as the process has exited.
+func startProcess(cmd *exec.Cmd) (*process, error) {
+	p := &process{
+		Cmd:    cmd,
+		exited: make(chan struct{}),
+	}
+	stdout, stdoutw, err := os.Pipe()
+	if err != nil {
+		return nil, errors.Wrap(err, "creating stdout pipe")
+	}
+	stderr, stderrw, err := os.Pipe()
+	if err != nil {
+		_ = stdout.Close()  // Best effort.
+		_ = stdoutw.Close() // Best effort.
+		return nil, errors.Wrap(err, "creating stderr pipe")
+	}
+	p.stdout = stdout
+	p.stderr = stderr
+
+	cmd.Stdout = stdoutw
+	cmd.Stderr = stderrw
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	err = cmd.Start()
+
+	// The process has its own copies of the write ends of the pipes.
+	_ = stdoutw.Close() // Best effort.
+	_ = stderrw.Close() // Best effort.
+
+	if err != nil {
+		_ = stdout.Close() // Best effort.
+		_ = stderr.Close() // Best effort.
+		return nil, errors.Wrap(err, "starting command")
+	}
+	p.started = time.Now()
+
+	return p, nil
+}
+
+// exitStatus describes how the process exited.
+// It should only be called after the process has exited.
+func (p *process) exitStatus() string {
+	if p.ProcessState == nil {
+		if p.err != nil {
+			return p.err.Error()
+		}
+		return "unknown"
+	}
+	return p.ProcessState.String()
+}
+
+// exitCode returns the exit code of the process,
+// or -1 if it was killed by a signal or could not be waited for.
+// It should only be called after the process has exited.
+func (p *process) exitCode() int {
+	if p.ProcessState == nil {
+		return -1
+	}
+	return p.ProcessState.ExitCode()
+}
+
+// piping returns a func that runs f and marks one of the process's pipes as finished when f returns.
+func (p *process) piping(f func() error) func() error {
+	p.piped.Add(1)
+
+	return func() error {
+		defer p.piped.Done()
+		return f()
+	}
+}
+
+// signal sends a signal to the process's group, so that any children the process started get it too,
+// and marks the process as stopped by gonzo, so that it is not restarted when it exits.
+// os.ErrProcessDone is returned if the process has already been waited for.
+func (p *process) signal(sig syscall.Signal) error {
+	p.stoppedMutex.Lock()
+	p.stopped = true
+	p.stoppedMutex.Unlock()
+
+	// The ID of the process group may have been reused once the process has been waited for.
+	if err := p.Process.Signal(syscall.Signal(0)); err != nil {
+		return err
+	}
+	return syscall.Kill(-p.Process.Pid, sig)
+}
+
+// stoppedByGonzo returns true if the process was signalled by gonzo.
+func (p *process) stoppedByGonzo() bool {
+	p.stoppedMutex.Lock()
+	defer p.stoppedMutex.Unlock()
+
+	return p.stopped
+}
+
+// setOwner sets the session that owns the process.
+func (p *process) setOwner(s *Session, clientID string) {
+	p.ownerMutex.Lock()
+	p.session = s
+	p.clientID = clientID
+	p.ownerMutex.Unlock()
+}
+
+// wait waits for the process to exit, then waits up to outputGrace for its output to be piped.
+func (p *process) wait() {
+	p.err = p.Wait()
+
+	piped := make(chan struct{})
+	go func() {
+		p.piped.Wait()
+		close(piped)
+	}()
+	select {
+	case <-piped:
+	case <-time.After(outputGrace):
+	}
+	// Closing the pipes stops the piping of output from children that are still running.
+	_ = p.stdout.Close() // Best effort.
+	_ = p.stderr.Close() // Best effort.
+	<-piped
+}
+
+// watch returns a func that waits for the process to exit,
+// then removes it from the session that owns it.
+func (p *process) watch() func() error {
+	return func() error {
+		p.wait()
+
+		p.ownerMutex.Lock()
+		p.session.exited(p.clientID, p)
+		p.ownerMutex.Unlock()
+
+		close(p.exited)
+		return nil
+	}
+}
+
+// logFile is a file that a process's output is piped to.
+// The file can be replaced while the process is running.
+type logFile struct {
+	f  *os.File
+	mu sync.Mutex
+}
+
+// Close closes the file.
+func (l *logFile) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.f.Close()
+}
+
+// Name returns the name of the file.
+func (l *logFile) Name() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.f.Name()
+}
+
+// Write writes to the file and syncs it.
+func (l *logFile) Write(b []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n, err := l.f.Write(b)
+	if err != nil {
+		return n, errors.Wrap(err, "writing to file")
+	}
+	return n, errors.Wrap(l.f.Sync(), "syncing file")
+}
+
+// replace replaces the file and closes the old one.
+func (l *logFile) replace(f *os.File) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	old := l.f
+	l.f = f
+	return old.Close()
+}
+
+// terminate sends SIGTERM to each process, and kills any that have not exited after the grace period.
+// It returns after every process has exited, or could not be killed.
+// The first error from signalling a process that has not already exited is returned.
+func terminate(dbg Debugger, procs map[string]*process, grace time.Duration) error {
+	var first error
+
+	for name, p := range procs {
+		if err := p.signal(syscall.SIGTERM); err != nil && err != os.ErrProcessDone {
+			dbg.Debugf("terminating %s: %s", name, err)
+			if first == nil {
+				first = errors.Wrapf(err, "terminating %s", name)
+			}
+		}
+	}
+	timeout := time.After(grace)
+
+	for name, p := range procs {
+		select {
+		case <-p.exited:
+			continue
+		case <-timeout:
+		}
+		dbg.Debugf("killing %s after %s", name, grace)
+		if err := p.signal(syscall.SIGKILL); err != nil && err != os.ErrProcessDone {
+			dbg.Debugf("killing %s: %s", name, err)
+			if first == nil {
+				first = errors.Wrapf(err, "killing %s", name)
+			}
+			continue // The process will never exit if it could not be killed.
+		}
+		<-p.exited
+	}
+	return first
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// testGoer runs funcs in goroutines.
+type testGoer struct{}
+
+func (testGoer) Go(f func() error) {
+	go func() { _ = f() }()
+}
+
+// launchTestClient launches a shell command as a client of a session.
+func launchTestClient(t *testing.T, sesh *Session, clientID, script string) *process {
+	t.Helper()
+
+	local, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = local.Close() })
+
+	entry := ManifestEntry{Name: "sh", Executable: "sh", ID: clientID, LaunchOptions: LaunchOptions{Args: []string{"-c", script}}}
+
+	if _, err := sesh.Launch(entry, local, testGoer{}); err != nil {
+		t.Fatal(err)
+	}
+	p, err := sesh.process(clientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Clean up anything the client leaves running.
+	t.Cleanup(func() { _ = syscall.Kill(-p.Process.Pid, syscall.SIGKILL) })
+
+	return p
+}
+
+func TestKillClientWithChild(t *testing.T) {
+	sesh := newTestSession(t)
+	launchTestClient(t, sesh, "nAAAA", "echo started; sleep 30 & sleep 30")
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := sesh.Kill("nAAAA")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(outputGrace):
+		t.Fatal("timed out killing a client with a child that inherited its output")
+	}
+	if _, err := sesh.process("nAAAA"); err == nil {
+		t.Fatal("expected the client to be removed")
+	}
+}
+
+func TestClientExitsWithChild(t *testing.T) {
+	sesh := newTestSession(t)
+	p := launchTestClient(t, sesh, "nAAAA", "echo started; sleep 30 &")
+
+	select {
+	case <-p.exited:
+	case <-time.After(outputGrace + 5*time.Second):
+		t.Fatal("timed out waiting for a client whose child inherited its output")
+	}
+	if expected, got := 0, p.exitCode(); expected != got {
+		t.Fatalf("expected exit code %d, got %d", expected, got)
+	}
+	if expected, got := "started\n", readTestFile(t, filepath.Join(sesh.Path, logsDirname, "nAAAA"+stdoutExt)); expected != got {
+		t.Fatalf("expected output %q, got %q", expected, got)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"github.com/scgolang/nsm"
+	"github.com/scgolang/osc"
+)
+
+// Quit closes the current session, replies to the sender, then shuts down the application.
+func (app *App) Quit(msg osc.Message) error {
+	app.Debug("quitting")
+
+	app.sessionMutex.Lock()
+	defer app.sessionMutex.Unlock()
+
+	var reply osc.Message
+	if err := app.closeCurrent(); err != nil {
+		reply = ReplyError(nsm.AddressServerQuit, nsm.ErrGeneral, err.Error())
+	} else {
+		reply = ReplySuccess(msg.Sender, nsm.AddressServerQuit, "quitting")
+	}
+	if err := app.SendTo(msg.Sender, reply); err != nil {
+		app.Debugf("sending quit reply: %s", err)
+	}
+	return app.stop()
+}
+
+// closeCurrent saves and closes the current session if there is one.
+// The session is closed even if it can not be saved.
+func (app *App) closeCurrent() error {
+	curr, err := app.sessions.Current()
+	if err == ErrNoSessionOpen {
+		return nil
+	}
+	failed, err := app.saveSession(curr)
+	if err != nil {
+		app.Debugf("saving session %s: %s", curr.Name(), err)
+	}
+	if len(failed) > 0 {
+		app.Debugf("these clients failed to save: %s", strings.Join(failed, ", "))
+	}
+	return errors.Wrap(app.sessions.Close(app.GracePeriod), "closing session")
+}
+
+// handleSignals closes the current session and shuts down the application
+// when the process receives SIGINT or SIGTERM.
+func (app *App) handleSignals() error {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	select {
+	case <-app.ctx.Done():
+		return nil
+	case sig := <-sigs:
+		app.Debugf("got %s, quitting", sig)
+	}
+	app.sessionMutex.Lock()
+	defer app.sessionMutex.Unlock()
+
+	if err := app.closeCurrent(); err != nil {
+		app.Debugf("closing current session: %s", err)
+	}
+	return app.stop()
+}
+
+// stop stops serving OSC and cancels the application's context.
+// Wait returns once every goroutine has finished, e.g. after
+// the output of every client has been written to its log files.
+func (app *App) stop() error {
+	var err error
+	app.stopOnce.Do(func() {
+		app.cancel()
+		err = errors.Wrap(app.Conn.Close(), "closing osc connection")
+	})
+	return err
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/scgolang/nsm"
+	"github.com/scgolang/osc"
+)
+
+// AddressClientRemove is the address used to remove a client from the current session.
+const AddressClientRemove = "/nsm/gui/client/remove"
+
+// RemoveClient stops a client and removes it from the current session.
+func (app *App) RemoveClient(msg osc.Message) (string, nsm.Error) {
+	const code = nsm.ErrGeneral
+
+	if expected, got := 1, len(msg.Arguments); expected != got {
+		return "", nsm.NewError(code, fmt.Sprintf("expected %d arguments, got %d", expected, got))
+	}
+	clientID, err := msg.Arguments[0].ReadString()
+	if err != nil {
+		return "", nsm.NewError(code, "reading string from message")
+	}
+	app.Debugf("removing client %s", clientID)
+
+	currentSession, err := app.sessions.Current()
+	if err != nil {
+		return "", nsm.NewError(nsm.ErrNoSessionOpen, err.Error())
+	}
+	if err := currentSession.RemoveClient(clientID); err != nil {
+		return "", nsm.NewError(code, err.Error())
+	}
+	return "removed client " + clientID, nil
+}
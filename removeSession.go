@@ -9,19 +9,34 @@ import (
 
 // RemoveSession removes a session.
 // If the session being removed is the current session and has clients
-// with unsaved changes then the session will not be removed an error reply will be sent.
+// with unsaved changes then the session will not be removed an error reply will be sent,
+// unless the force argument is provided.
+// Otherwise the current session is closed without saving before it is removed.
 func (app *App) RemoveSession(msg osc.Message) (string, nsm.Error) {
 	const code = nsm.ErrUnsavedChanges
 
-	if expected, got := 1, len(msg.Arguments); expected != got {
-		return "", nsm.NewError(code, fmt.Sprintf("expected %d arguments, got %d", expected, got))
+	if min, max, got := 1, 2, len(msg.Arguments); got < min || got > max {
+		return "", nsm.NewError(code, fmt.Sprintf("expected %d or %d arguments, got %d", min, max, got))
 	}
 	name, err := msg.Arguments[0].ReadString()
 	if err != nil {
 		return "", nsm.NewError(code, "reading string from message")
 	}
+	force, err := ReadForce(msg, 1)
+	if err != nil {
+		return "", nsm.NewError(code, err.Error())
+	}
 	app.Debugf("removing session named %s", name)
 
+	// The current session is closed before it is removed.
+	if curr, err := app.sessions.Current(); err == nil && curr.Name() == name {
+		if curr.Dirty() && !force {
+			return "", nsm.NewError(code, "session "+name+" has unsaved changes")
+		}
+		if err := app.sessions.Close(app.GracePeriod); err != nil {
+			return "", nsm.NewError(nsm.ErrGeneral, err.Error())
+		}
+	}
 	if err := app.sessions.Remove(name); err != nil {
 		return "", nsm.NewError(code, err.Error())
 	}
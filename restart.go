@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/scgolang/osc"
+)
+
+// AddressGUIClientCrashed is used to tell controllers that a client's process failed.
+// The arguments are the client's ID, its exit code, a description of how it exited,
+// and the last lines it wrote to stderr.
+const AddressGUIClientCrashed = "/nsm/gui/client/crashed"
+
+// Restarts of a client are delayed by restartBackoff, which doubles for every restart
+// in the last restartWindow up to maxRestartBackoff.
+// A client that has been restarted maxRestarts times in the last restartWindow is not restarted again.
+const (
+	restartBackoff    = time.Second
+	maxRestartBackoff = 30 * time.Second
+	maxRestarts       = 5
+	restartWindow     = time.Minute
+)
+
+// crashLogLines is the number of lines from a client's stderr that are sent to controllers when it crashes.
+const crashLogLines = 10
+
+// ClientExit describes how a client's process exited.
+type ClientExit struct {
+	// Code is the exit code of the process, or -1 if it was killed by a signal.
+	Code int
+
+	// Status describes how the process exited.
+	Status string
+
+	// Stderr contains the last lines the process wrote to stderr.
+	Stderr []string
+}
+
+// Supervisor is notified when a client's process exits without being stopped by gonzo.
+type Supervisor interface {
+	ClientExited(s *Session, clientID string, exit ClientExit)
+}
+
+// ClientExited tells controllers when a client crashes,
+// and restarts the client if its restart policy says so.
+func (app *App) ClientExited(sesh *Session, clientID string, exit ClientExit) {
+	if exit.Code != 0 {
+		app.Notify(crashMessage(clientID, exit))
+	}
+	entry, ok := sesh.Entry(clientID)
+	if !ok || !entry.Restart.Restarts(exit.Code) {
+		return
+	}
+	delay, ok := app.restartDelay(sesh, clientID)
+	if !ok {
+		app.Debugf("client %s was restarted %d times in %s, not restarting it again", clientID, maxRestarts, restartWindow)
+		return
+	}
+	app.Debugf("restarting client %s in %s", clientID, delay)
+
+	app.Go(func() error {
+		if err := app.restartClient(sesh, clientID, delay); err != nil {
+			app.Debugf("restarting client %s: %s", clientID, err)
+		}
+		return nil
+	})
+}
+
+// restartClient relaunches a client after a delay and tells it to open its project once it has announced itself.
+// The client is not restarted if its session is no longer open, it has been removed from the session,
+// or it is already running again.
+func (app *App) restartClient(sesh *Session, clientID string, delay time.Duration) error {
+	select {
+	case <-app.ctx.Done():
+		return nil
+	case <-time.After(delay):
+	}
+	if curr, err := app.sessions.Current(); err != nil || curr != sesh {
+		return errors.New("session " + sesh.Name() + " is not open")
+	}
+	entry, ok := sesh.Entry(clientID)
+	if !ok {
+		return errors.New("client is not in the session's manifest: " + clientID)
+	}
+	pid, err := sesh.Launch(entry, app.Conn, app)
+	if err != nil {
+		return errors.Wrap(err, "launching client")
+	}
+	return app.openClient(sesh, clientID, pid)
+}
+
+// restartDelay records a restart of a client and returns how long to wait before restarting it.
+// The returned bool is false if the client has already been restarted too many times.
+func (app *App) restartDelay(sesh *Session, clientID string) (time.Duration, bool) {
+	var (
+		key    = filepath.Join(sesh.Path, clientID)
+		now    = time.Now()
+		recent = []time.Time{}
+	)
+	app.restartsMutex.Lock()
+	defer app.restartsMutex.Unlock()
+
+	for _, t := range app.restarts[key] {
+		if now.Sub(t) < restartWindow {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= maxRestarts {
+		app.restarts[key] = recent
+		return 0, false
+	}
+	app.restarts[key] = append(recent, now)
+
+	return backoff(len(recent)), true
+}
+
+// backoff returns how long to wait before restarting a client that has been restarted n times in the last restartWindow.
+func backoff(n int) time.Duration {
+	delay := restartBackoff
+	for i := 0; i < n && delay < maxRestartBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxRestartBackoff {
+		return maxRestartBackoff
+	}
+	return delay
+}
+
+// crashMessage returns the message that tells controllers a client has crashed.
+func crashMessage(clientID string, exit ClientExit) osc.Message {
+	msg := osc.Message{
+		Address: AddressGUIClientCrashed,
+		Arguments: osc.Arguments{
+			osc.String(clientID),
+			osc.Int(exit.Code),
+			osc.String(exit.Status),
+		},
+	}
+	for _, line := range exit.Stderr {
+		msg.Arguments = append(msg.Arguments, osc.String(line))
+	}
+	return msg
+}
+
+// lastLines returns the last n non-empty lines of a file.
+func lastLines(path string, n int) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "opening %s", path)
+	}
+	defer func() { _ = f.Close() }() // Best effort.
+
+	var (
+		lines = []string{}
+		sc    = bufio.NewScanner(f)
+	)
+	for sc.Scan() {
+		line := strings.TrimSpace(strings.Trim(sc.Text(), "\x00"))
+		if len(line) == 0 {
+			continue
+		}
+		lines = append(lines, line)
+		if len(lines) > n {
+			lines = lines[1:]
+		}
+	}
+	return lines, errors.Wrapf(sc.Err(), "scanning %s", path)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	for _, testcase := range []struct {
+		restarts int
+		expected time.Duration
+	}{
+		{0, restartBackoff},
+		{1, 2 * restartBackoff},
+		{2, 4 * restartBackoff},
+		{4, 16 * restartBackoff},
+		{5, maxRestartBackoff},
+		{6, maxRestartBackoff},
+		{100, maxRestartBackoff},
+	} {
+		if expected, got := testcase.expected, backoff(testcase.restarts); expected != got {
+			t.Fatalf("expected %s after %d restarts, got %s", expected, testcase.restarts, got)
+		}
+	}
+}
+
+func TestRestartDelay(t *testing.T) {
+	var (
+		app  = &App{restarts: map[string][]time.Time{}}
+		sesh = &Session{Path: "/tmp/song"}
+		key  = filepath.Join(sesh.Path, "n1")
+	)
+	for i := 0; i < maxRestarts; i++ {
+		delay, ok := app.restartDelay(sesh, "n1")
+		if !ok {
+			t.Fatalf("expected restart %d to be allowed", i)
+		}
+		if expected, got := backoff(i), delay; expected != got {
+			t.Fatalf("expected restart %d to be delayed by %s, got %s", i, expected, got)
+		}
+	}
+	if _, ok := app.restartDelay(sesh, "n1"); ok {
+		t.Fatalf("expected no more than %d restarts in %s", maxRestarts, restartWindow)
+	}
+	// Other clients are counted separately.
+	if delay, ok := app.restartDelay(sesh, "n2"); !ok || delay != restartBackoff {
+		t.Fatalf("expected the first restart of another client to be delayed by %s, got %s (%t)", restartBackoff, delay, ok)
+	}
+	// Restarts that are older than the window are forgotten.
+	app.restarts[key] = app.restarts[key][:0]
+	for i := 0; i < maxRestarts; i++ {
+		app.restarts[key] = append(app.restarts[key], time.Now().Add(-restartWindow))
+	}
+	delay, ok := app.restartDelay(sesh, "n1")
+	if !ok {
+		t.Fatal("expected old restarts to be forgotten")
+	}
+	if expected, got := restartBackoff, delay; expected != got {
+		t.Fatalf("expected %s, got %s", expected, got)
+	}
+	if expected, got := 1, len(app.restarts[key]); expected != got {
+		t.Fatalf("expected %d recent restart, got %d", expected, got)
+	}
+}
+
+func TestRestartPolicyRestarts(t *testing.T) {
+	for _, testcase := range []struct {
+		policy   RestartPolicy
+		code     int
+		restarts bool
+	}{
+		{"", 0, false},
+		{"", 1, false},
+		{RestartNever, 0, false},
+		{RestartNever, 1, false},
+		{RestartNever, -1, false},
+		{RestartOnFailure, 0, false},
+		{RestartOnFailure, 1, true},
+		{RestartOnFailure, -1, true},
+		{RestartAlways, 0, true},
+		{RestartAlways, 1, true},
+		{RestartAlways, -1, true},
+	} {
+		if expected, got := testcase.restarts, testcase.policy.Restarts(testcase.code); expected != got {
+			t.Fatalf("expected %q restarting after exit code %d to be %t, got %t", testcase.policy, testcase.code, expected, got)
+		}
+	}
+}
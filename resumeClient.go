@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/scgolang/nsm"
+	"github.com/scgolang/osc"
+)
+
+// AddressClientResume is the address used to relaunch a client that has been stopped.
+const AddressClientResume = "/nsm/gui/client/resume"
+
+// ResumeClient relaunches a client in the current session that is not running,
+// and tells it to open its project.
+// The reply is sent after the client has replied to the open message or timed out.
+func (app *App) ResumeClient(msg osc.Message) (string, nsm.Error) {
+	const code = nsm.ErrLaunchFailed
+
+	if expected, got := 1, len(msg.Arguments); expected != got {
+		return "", nsm.NewError(code, fmt.Sprintf("expected %d arguments, got %d", expected, got))
+	}
+	clientID, err := msg.Arguments[0].ReadString()
+	if err != nil {
+		return "", nsm.NewError(code, "reading string from message")
+	}
+	currentSession, err := app.sessions.Current()
+	if err != nil {
+		return "", nsm.NewError(nsm.ErrNoSessionOpen, err.Error())
+	}
+	app.Debugf("resuming client %s", clientID)
+
+	entry, found := currentSession.Entry(clientID)
+	if !found {
+		return "", nsm.NewError(code, "client does not exist: "+clientID)
+	}
+	pid, err := currentSession.Launch(entry, app.Conn, app)
+	if err != nil {
+		return "", nsm.NewError(code, err.Error())
+	}
+	if err := app.openClient(currentSession, clientID, pid); err != nil {
+		return "", nsm.NewError(code, err.Error())
+	}
+	return "resumed client " + clientID, nil
+}
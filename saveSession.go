@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/scgolang/nsm"
+	"github.com/scgolang/osc"
+)
+
+// saveTimeout is how long we wait for a client to reply to a save message.
+const saveTimeout = 30 * time.Second
+
+// SaveSession tells every client in the current session to save, then saves the session itself.
+// If every client saved and the session has a history then the session's directory is committed to it.
+// The reply is sent after every client has replied to the save message or timed out.
+func (app *App) SaveSession(msg osc.Message) (string, nsm.Error) {
+	sesh, err := app.sessions.Current()
+	if err != nil {
+		return "", nsm.NewError(nsm.ErrNoSessionOpen, err.Error())
+	}
+	failed, err := app.saveSession(sesh)
+	if err != nil {
+		return "", nsm.NewError(nsm.ErrGeneral, err.Error())
+	}
+	if len(failed) > 0 {
+		return "", nsm.NewError(nsm.ErrGeneral, "these clients failed to save: "+strings.Join(failed, ", "))
+	}
+	commit, err := app.commitSession(sesh)
+	if err != nil {
+		return "", nsm.NewError(nsm.ErrGeneral, "saved session "+sesh.Name()+" but could not commit it: "+err.Error())
+	}
+	if commit != "" {
+		return "saved session " + sesh.Name() + " as " + commit, nil
+	}
+	return "saved session " + sesh.Name(), nil
+}
+
+// commitSession commits a session's directory to its history, with a message that lists the clients that saved.
+// If the history option is set then sessions without a history are given one.
+// It returns the abbreviated hash of the commit, which is empty if the session has no history or nothing changed.
+func (app *App) commitSession(sesh *Session) (string, error) {
+	if !sesh.HasHistory() {
+		if !app.History {
+			return "", nil
+		}
+		if err := sesh.InitHistory(); err != nil {
+			return "", errors.Wrap(err, "initializing history")
+		}
+	}
+	clients := []string{}
+	for clientID, client := range sesh.Clients() {
+		clients = append(clients, fmt.Sprintf("%s (%s)", client.ApplicationName, clientID))
+	}
+	sort.Strings(clients)
+
+	message := "save session " + sesh.Name()
+	if len(clients) > 0 {
+		message += "\n\nSaved clients:\n" + strings.Join(clients, "\n")
+	}
+	return sesh.Commit(message)
+}
+
+// saveSession tells every client in a session to save, then saves the session itself.
+// It returns a description of each client that failed to save.
+func (app *App) saveSession(sesh *Session) ([]string, error) {
+	app.Debugf("saving session %s", sesh.Name())
+
+	failed := app.saveClients(sesh)
+
+	if err := sesh.Save(); err != nil {
+		return failed, errors.Wrap(err, "saving session "+sesh.Name())
+	}
+	return failed, nil
+}
+
+// saveClients tells every client in a session to save.
+// It returns a description of each client that failed to save.
+func (app *App) saveClients(sesh *Session) []string {
+	var (
+		failed      = []string{}
+		failedMutex sync.Mutex
+		wg          sync.WaitGroup
+	)
+	for clientID, client := range sesh.Clients() {
+		wg.Add(1)
+		go func(clientID string, client *Client) {
+			defer wg.Done()
+
+			if err := app.saveClient(client); err != nil {
+				app.Debugf("saving client %s: %s", clientID, err)
+				failedMutex.Lock()
+				failed = append(failed, fmt.Sprintf("%s (%s)", client.ApplicationName, clientID))
+				failedMutex.Unlock()
+				return
+			}
+			// Clients that have saved successfully have no unsaved changes.
+			if client.HasCapability(nsm.CapClientDirty) {
+				if err := sesh.SetDirty(client.Addr, false); err != nil {
+					app.Debugf("marking client %s clean: %s", clientID, err)
+				}
+			}
+		}(clientID, client)
+	}
+	wg.Wait()
+	return failed
+}
+
+// saveClient tells a client to save.
+func (app *App) saveClient(client *Client) error {
+	_, err := app.Request(client.Addr, osc.Message{Address: nsm.AddressClientSave}, saveTimeout)
+	return errors.Wrap(err, "requesting "+nsm.AddressClientSave)
+}
@@ -9,6 +9,8 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/scgolang/exec"
@@ -18,7 +20,14 @@ import (
 
 const currentSessionCache = ".current"
 
+// logsDirname is the name of the directory in a session's directory
+// where the output of the session's clients is stored.
+const logsDirname = ".logs"
+
 type sessionClient struct {
+	executable string
+	exitStatus string
+	lifecycle  Lifecycle
 	stderrPath string
 	stdoutPath string
 }
@@ -28,95 +37,213 @@ type Session struct {
 	Dir  *os.File
 	Path string
 
+	// clients maps client ID's to clients that have announced themselves.
 	clients      ClientMap
 	clientsMutex sync.RWMutex
 
-	cmdgrp *exec.Group
+	// procs maps client ID's to running processes.
+	procs      map[string]*process
+	procsMutex sync.RWMutex
 
+	ctx context.Context
 	dbg Debugger
+	sup Supervisor
+
+	manifest      Manifest
+	manifestMutex sync.RWMutex
+
+	// pending maps the pids of launched clients to channels
+	// that receive the client when it announces itself.
+	pending      map[Pid]chan *Client
+	pendingMutex sync.Mutex
 
+	// sessionClients maps client ID's to the files where their output is stored.
 	sessionClients      map[string]*sessionClient
 	sessionClientsMutex sync.RWMutex
+
+	state      SessionState
+	stateMutex sync.RWMutex
+
+	meta      SessionMeta
+	metaMutex sync.RWMutex
 }
 
 // NewSession creates a new session.
-func NewSession(ctx context.Context, dbg Debugger, file string) (*Session, error) {
+// The supervisor is notified when the session's clients exit without being stopped by gonzo.
+func NewSession(ctx context.Context, dbg Debugger, sup Supervisor, file string) (*Session, error) {
 	s := &Session{
 		Path:           file,
 		clients:        ClientMap{},
-		cmdgrp:         exec.NewGroup(ctx),
+		procs:          map[string]*process{},
+		ctx:            ctx,
 		dbg:            dbg,
+		sup:            sup,
+		manifest:       Manifest{},
+		pending:        map[Pid]chan *Client{},
 		sessionClients: map[string]*sessionClient{},
+		state:          SessionState{Clients: map[string]ClientState{}},
 	}
 	if err := s.initializeDirectory(); err != nil {
 		return nil, errors.Wrap(err, "initializing session")
 	}
+	if err := s.readManifest(); err != nil {
+		return nil, errors.Wrap(err, "reading manifest")
+	}
+	if err := s.readState(); err != nil {
+		return nil, errors.Wrap(err, "reading state")
+	}
+	if err := s.readMeta(); err != nil {
+		return nil, errors.Wrap(err, "reading metadata")
+	}
+	s.applyLaunchOptions()
+
 	return s, nil
 }
 
 // Announce handles a client announcement.
-func (s *Session) Announce(msg osc.Message) (*Client, error) {
+// The returned bool is true if the session launched the client and is waiting for its announcement.
+func (s *Session) Announce(msg osc.Message) (*Client, bool, error) {
 	client, pid, err := s.clientFromAnnounce(msg)
 	if err != nil {
-		return nil, errors.Wrap(err, "creating client from announce message")
+		return nil, false, errors.Wrap(err, "creating client from announce message")
 	}
 
-	s.clientsMutex.RLock()
-	if _, ok := s.clients[pid]; ok {
-		s.clientsMutex.RUnlock()
-		return nil, errors.Errorf("client with pid %d already exists", pid)
-	}
-	s.clientsMutex.RUnlock()
+	client.ID = s.clientID(pid)
 
 	s.clientsMutex.Lock()
-	s.clients[pid] = client
+	for _, c := range s.clients {
+		if c.Pid == pid {
+			s.clientsMutex.Unlock()
+			return nil, false, errors.Errorf("client with pid %d already exists", pid)
+		}
+	}
+	s.clients[client.ID] = client
 	s.clientsMutex.Unlock()
 
-	return client, nil
+	s.transition(client.ID, pid, StateAnnounced)
+
+	// Notify anyone waiting for the client to announce itself.
+	s.pendingMutex.Lock()
+	announced, awaited := s.pending[pid]
+	s.pendingMutex.Unlock()
+	if awaited {
+		announced <- client
+	}
+	return client, awaited, nil
 }
 
-// Clients returns the session's ClientMap.
+// Client returns a copy of the running client with the provided ID.
+func (s *Session) Client(clientID string) (Client, error) {
+	s.clientsMutex.RLock()
+	defer s.clientsMutex.RUnlock()
+
+	c, ok := s.clients[clientID]
+	if !ok {
+		return Client{}, errors.Errorf("client %s is not running", clientID)
+	}
+	return *c, nil
+}
+
+// Clients returns a copy of the session's ClientMap.
 // It is very important to use this method as opposed to accessing
 // the struct field directly since concurrent access to maps is not safe in Go.
+// Note that the clients are also copied, since their state can change.
 func (s *Session) Clients() ClientMap {
 	cm := ClientMap{}
 	s.clientsMutex.RLock()
-	for pid, c := range s.clients {
-		cm[pid] = c
+	for clientID, c := range s.clients {
+		client := *c
+		cm[clientID] = &client
 	}
 	s.clientsMutex.RUnlock()
 	return cm
 }
 
-// CreateCmdDirectory creates a directory for a process with the provided name.
-func (s *Session) CreateCmdDirectory(cmdname string) error {
-	cmdpath := filepath.Join(s.Path, cmdname)
-	if _, err := openOrCreateDir(cmdpath); err != nil {
-		return errors.Wrapf(err, "opening or creating %s", cmdpath)
+// ClientPath returns the path where a client stores its project data.
+// The path has the form <session>/<name>.<id>, which is the same as Non Session Manager.
+func (s *Session) ClientPath(entry ManifestEntry) string {
+	return filepath.Join(s.Path, clientDirname(entry))
+}
+
+// clientDirname returns the name of the directory in a session's directory where a client stores its project data.
+func clientDirname(entry ManifestEntry) string {
+	name := entry.Name
+	if name == "" {
+		name = filepath.Base(entry.Executable)
 	}
-	return nil
+	return name + "." + entry.ID
+}
+
+// Close stops all the session's clients.
+// Clients are stopped one launch group at a time, in the reverse of the order they were launched,
+// and clients that are not in the session's manifest are stopped first.
+// Each client is sent SIGTERM, and clients that have not exited
+// after the grace period are killed.
+// Every client is stopped even if stopping one of them fails, and the first error is returned.
+func (s *Session) Close(grace time.Duration) error {
+	var first error
+
+	for _, procs := range s.stopOrder() {
+		if err := terminate(s.dbg, procs, grace); err != nil && first == nil {
+			first = err
+		}
+	}
+
+	s.clientsMutex.Lock()
+	s.clients = ClientMap{}
+	s.clientsMutex.Unlock()
+
+	s.pendingMutex.Lock()
+	s.pending = map[Pid]chan *Client{}
+	s.pendingMutex.Unlock()
+
+	s.sessionClientsMutex.Lock()
+	s.sessionClients = map[string]*sessionClient{}
+	s.sessionClientsMutex.Unlock()
+
+	return errors.Wrap(first, "stopping clients")
 }
 
 // Dirty returns true if there are clients in the session with unsaved changes, false otherwise.
 func (s *Session) Dirty() bool {
-	// TODO
+	s.clientsMutex.RLock()
+	defer s.clientsMutex.RUnlock()
+
+	for _, c := range s.clients {
+		if c.Dirty {
+			return true
+		}
+	}
 	return false
 }
 
+// Entry returns the manifest entry of the client with the provided ID.
+// The returned bool is false if the client is not in the session's manifest.
+func (s *Session) Entry(clientID string) (ManifestEntry, bool) {
+	s.manifestMutex.RLock()
+	defer s.manifestMutex.RUnlock()
+
+	for _, entry := range s.manifest {
+		if entry.ID == clientID {
+			return entry, true
+		}
+	}
+	return ManifestEntry{}, false
+}
+
 // Logs returns a channel that emits lines from the log file of a given client.
-// An error will be returned if the client with the provided name does not exist
+// An error will be returned if the client with the provided ID does not exist
 // or if logtype is not stderr or stdout.
-func (s *Session) Logs(clientName string, fd int32) (osc.Message, error) {
-	clientPath := filepath.Join(s.Path, clientName)
+func (s *Session) Logs(clientID string, fd int32) (osc.Message, error) {
 	var (
 		client *sessionClient
 		exists bool
 	)
-	s.clientsMutex.RLock()
-	client, exists = s.sessionClients[clientPath]
-	s.clientsMutex.RUnlock()
+	s.sessionClientsMutex.RLock()
+	client, exists = s.sessionClients[clientID]
+	s.sessionClientsMutex.RUnlock()
 	if !exists {
-		return osc.Message{}, errors.New("client does not exist: " + clientName)
+		return osc.Message{}, errors.New("client does not exist: " + clientID)
 	}
 	if fd != stdoutArg && fd != stderrArg {
 		return osc.Message{}, errors.Errorf("fd must be either %d or %d", stdoutArg, stderrArg)
@@ -137,12 +264,118 @@ func (s *Session) Logs(clientName string, fd int32) (osc.Message, error) {
 
 	s.dbg.Debugf("getting logs from file %s", streamPath)
 
-	return s.linesToMessage(f, clientName)
+	return s.linesToMessage(f, clientID)
 }
 
-// Open opens the session.
-func (s *Session) Open() error {
-	return nil
+// GUIVisible returns the last reported visibility of the optional GUI of the client with the provided ID.
+// The returned bool is false if the client's GUI visibility is not known.
+func (s *Session) GUIVisible(clientID string) (visible bool, known bool) {
+	s.stateMutex.RLock()
+	defer s.stateMutex.RUnlock()
+
+	state, ok := s.state.Clients[clientID]
+	if !ok || state.GUIVisible == nil {
+		return false, false
+	}
+	return *state.GUIVisible, true
+}
+
+// Kill kills the client with the provided ID.
+// It returns a description of how the client's process exited.
+func (s *Session) Kill(clientID string) (string, error) {
+	p, err := s.process(clientID)
+	if err != nil {
+		return "", err
+	}
+	if err := p.signal(syscall.SIGKILL); err != nil {
+		s.dbg.Debugf("killing %s: %s", clientID, err)
+	}
+	<-p.exited
+	return p.exitStatus(), nil
+}
+
+// KillAll kills all the session's clients.
+func (s *Session) KillAll() {
+	procs := s.processes()
+	for clientID, p := range procs {
+		if err := p.signal(syscall.SIGKILL); err != nil {
+			s.dbg.Debugf("killing %s: %s", clientID, err)
+		}
+	}
+	for _, p := range procs {
+		<-p.exited
+	}
+}
+
+// Launch starts the client described by a manifest entry and pipes its output to the session's directory.
+// The returned pid can be passed to WaitAnnounce to wait for the client to announce itself.
+func (s *Session) Launch(entry ManifestEntry, local net.Conn, g Goer) (Pid, error) {
+	p, err := s.start(entry, local)
+	if err != nil {
+		return 0, errors.Wrap(err, "starting client")
+	}
+	pid := Pid(p.Process.Pid)
+
+	if err := s.PipeOutputFor(entry.ID, g); err != nil {
+		s.abandon(entry.ID, p)
+		return 0, errors.Wrap(err, "piping client output")
+	}
+	return pid, nil
+}
+
+// abandon kills a process that was started but is not being watched,
+// waits for it to exit, and removes it from the session.
+func (s *Session) abandon(clientID string, p *process) {
+	if err := p.signal(syscall.SIGKILL); err != nil {
+		s.dbg.Debugf("killing %s: %s", clientID, err)
+	}
+	_ = p.watch()() // Always returns nil.
+
+	s.pendingMutex.Lock()
+	delete(s.pending, Pid(p.Process.Pid))
+	s.pendingMutex.Unlock()
+}
+
+// Manifest returns a copy of the session's manifest.
+func (s *Session) Manifest() Manifest {
+	s.manifestMutex.RLock()
+	m := make(Manifest, len(s.manifest))
+	copy(m, s.manifest)
+	s.manifestMutex.RUnlock()
+	return m
+}
+
+// Name returns the name of the session.
+func (s *Session) Name() string {
+	return filepath.Base(s.Path)
+}
+
+// Open launches the clients described by the provided manifest entries,
+// which are usually one of the launch groups of the session's manifest.
+// It returns the pids of the clients that were launched, keyed by client ID.
+// An error is returned if any of the clients could not be launched,
+// but the clients that were launched are still returned.
+func (s *Session) Open(entries Manifest, local net.Conn, g Goer) (map[string]Pid, error) {
+	var (
+		errs = []string{}
+		pids = map[string]Pid{}
+	)
+	for _, entry := range entries {
+		if _, err := s.process(entry.ID); err == nil {
+			continue // Already running, e.g. after switching from another session.
+		}
+		pid, err := s.Launch(entry, local, g)
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "launching %s", entry.ID).Error())
+			continue
+		}
+		s.dbg.Debugf("launched client %s with pid %d", entry.ID, pid)
+		pids[entry.ID] = pid
+	}
+	if len(errs) > 0 {
+		return pids, errors.New(strings.Join(errs, " and "))
+	}
+	return pids, nil
 }
 
 // Goer can run goroutines based on func's that return an error.
@@ -150,91 +383,259 @@ type Goer interface {
 	Go(func() error)
 }
 
+// Extensions of the files where the output of clients is stored.
 const (
-	stdoutFilename = ".stdout"
-	stderrFilename = ".stderr"
+	stdoutExt = ".stdout"
+	stderrExt = ".stderr"
 )
 
-// PipeOutputFor pipes the output for the specified process to files in the session's directory.
-func (s *Session) PipeOutputFor(cmdname string, g Goer) error {
-	var (
-		clientPath = filepath.Join(s.Path, cmdname)
-		stdoutPath = filepath.Join(clientPath, stdoutFilename)
-		stderrPath = filepath.Join(clientPath, stderrFilename)
-	)
-	s.dbg.Debugf("client stdout path %s", stdoutPath)
-	s.dbg.Debugf("client stderr path %s", stderrPath)
-
+// PipeOutputFor pipes the output for the client with the provided ID to files in the session's directory.
+// It also starts a goroutine that waits for the client's process to exit.
+func (s *Session) PipeOutputFor(clientID string, g Goer) error {
 	// Create the files where we will store the output.
-	stdoutFile, err := os.Create(stdoutPath)
+	stdoutFile, stderrFile, err := s.createLogFiles(clientID)
 	if err != nil {
-		return errors.Wrap(err, "creating "+stdoutPath)
+		return err
 	}
-	stderrFile, err := os.Create(stderrPath)
+
+	// Pipe the output to the newly created files.
+	p, err := s.process(clientID)
 	if err != nil {
-		return errors.Wrap(err, "creating "+stderrPath)
+		return errors.Wrap(err, "getting output for "+clientID)
 	}
+	p.stdoutLog = &logFile{f: stdoutFile}
+	p.stderrLog = &logFile{f: stderrFile}
 
-	// Pipe the output to the newly created files.
-	stdout, stderr, err := s.cmdgrp.Output(cmdname)
+	g.Go(p.piping(s.pipeSync(p.stdoutLog, p.stdout)))
+	g.Go(p.piping(s.pipeSync(p.stderrLog, p.stderr)))
+	g.Go(p.watch())
+
+	s.addLogFiles(clientID, stdoutFile.Name(), stderrFile.Name())
+
+	return nil
+}
+
+// Record adds a client to the session's manifest, replacing any entry that has the same ID,
+// and writes the manifest to disk.
+// Entries that would corrupt the manifest are refused.
+func (s *Session) Record(entry ManifestEntry) error {
+	if err := entry.Validate(); err != nil {
+		return errors.Wrap(err, "validating client")
+	}
+	s.manifestMutex.Lock()
+	s.manifest = append(s.manifest.Without(entry.ID), entry)
+	s.manifestMutex.Unlock()
+
+	if err := s.writeManifest(); err != nil {
+		return errors.Wrap(err, "writing manifest")
+	}
+	// Launch options are saved in the state file, since they are not part of the manifest.
+	s.stateMutex.Lock()
+	state := s.state.Clients[entry.ID]
+	changed := !state.LaunchOptions.Equal(entry.LaunchOptions)
+	if changed {
+		state.LaunchOptions = entry.LaunchOptions
+		s.state.Clients[entry.ID] = state
+	}
+	s.stateMutex.Unlock()
+
+	if !changed {
+		return nil
+	}
+	return errors.Wrap(s.writeState(), "writing state")
+}
+
+// RemoveClient stops the client with the provided ID, removes it from the session's manifest,
+// and writes the manifest to disk.
+// Note that the client's directory is left on disk.
+func (s *Session) RemoveClient(clientID string) error {
+	s.manifestMutex.Lock()
+	if !s.manifest.Contains(clientID) {
+		s.manifestMutex.Unlock()
+		return errors.New("client does not exist: " + clientID)
+	}
+	s.manifest = s.manifest.Without(clientID)
+	s.manifestMutex.Unlock()
+
+	if status, err := s.Kill(clientID); err == nil {
+		s.dbg.Debugf("killed %s: %s", clientID, status)
+	}
+	if err := s.writeManifest(); err != nil {
+		return errors.Wrap(err, "writing manifest")
+	}
+	s.stateMutex.Lock()
+	_, hasState := s.state.Clients[clientID]
+	delete(s.state.Clients, clientID)
+	s.stateMutex.Unlock()
+
+	if !hasState {
+		return nil
+	}
+	return errors.Wrap(s.writeState(), "writing state")
+}
+
+// Stop sends SIGTERM to the client with the provided ID,
+// and kills it if it has not exited after the grace period.
+// It returns a description of how the client's process exited.
+func (s *Session) Stop(clientID string, grace time.Duration) (string, error) {
+	p, err := s.process(clientID)
 	if err != nil {
-		return errors.Wrap(err, "getting output for "+cmdname)
+		return "", err
 	}
-	g.Go(s.pipeSync(stdoutFile, stdout))
-	g.Go(s.pipeSync(stderrFile, stderr))
+	if err := terminate(s.dbg, map[string]*process{clientID: p}, grace); err != nil {
+		return "", err
+	}
+	return p.exitStatus(), nil
+}
 
-	// Add the pipes to the session clients.
-	s.sessionClientsMutex.Lock()
-	if _, ok := s.sessionClients[clientPath]; !ok {
-		s.sessionClients[clientPath] = &sessionClient{}
+// SetDirty records whether the client with the provided address has unsaved changes.
+// An error is returned if the client does not have the dirty capability.
+func (s *Session) SetDirty(addr net.Addr, dirty bool) error {
+	_, err := s.updateClient(addr, nsm.CapClientDirty, func(c *Client) {
+		c.Dirty = dirty
+	})
+	return err
+}
+
+// SetGUIVisible records whether the client with the provided address is showing its optional GUI.
+// The visibility of the GUI is saved so that it can be restored when the session is reopened.
+// It returns a copy of the updated client.
+// An error is returned if the client does not have the optional-gui capability.
+func (s *Session) SetGUIVisible(addr net.Addr, visible bool) (Client, error) {
+	client, err := s.updateClient(addr, nsm.CapGUI, func(c *Client) {
+		c.GUIVisible = visible
+	})
+	if err != nil {
+		return Client{}, err
 	}
-	s.sessionClients[clientPath].stderrPath = stderrPath
-	s.sessionClients[clientPath].stdoutPath = stdoutPath
-	s.sessionClientsMutex.Unlock()
+	s.manifestMutex.RLock()
+	inManifest := s.manifest.Contains(client.ID)
+	s.manifestMutex.RUnlock()
+
+	if !inManifest {
+		return client, nil
+	}
+	s.stateMutex.Lock()
+	state := s.state.Clients[client.ID]
+	state.GUIVisible = &visible
+	s.state.Clients[client.ID] = state
+	s.stateMutex.Unlock()
 
+	return client, errors.Wrap(s.writeState(), "writing state")
+}
+
+// SetOpenResult records how the client with the provided ID replied to an open message.
+func (s *Session) SetOpenResult(clientID string, opened bool, result string) error {
+	s.clientsMutex.Lock()
+	c, ok := s.clients[clientID]
+	if !ok {
+		s.clientsMutex.Unlock()
+		return errors.Errorf("client %s is not running", clientID)
+	}
+	c.Opened = opened
+	c.OpenResult = result
+	pid := c.Pid
+	s.clientsMutex.Unlock()
+
+	if opened {
+		s.transition(clientID, pid, StateOpened)
+	} else {
+		s.transition(clientID, pid, StateAnnounced)
+	}
 	return nil
 }
 
-// Save saves the session.
+// SetProgress records the progress of an operation for the client with the provided address.
+// It returns a copy of the updated client.
+// An error is returned if the client does not have the progress capability.
+func (s *Session) SetProgress(addr net.Addr, progress float32) (Client, error) {
+	return s.updateClient(addr, nsm.CapClientProgress, func(c *Client) {
+		c.Progress = progress
+	})
+}
+
+// SetStatus records the latest status message for the client with the provided address.
+// It returns a copy of the updated client.
+// An error is returned if the client does not have the message capability.
+func (s *Session) SetStatus(addr net.Addr, priority int32, status string) (Client, error) {
+	return s.updateClient(addr, nsm.CapClientMessage, func(c *Client) {
+		c.Priority = priority
+		c.Status = status
+	})
+}
+
+// Save saves the session's manifest and records when the session was saved.
+// Note that it is up to the caller to tell the session's clients to save.
 func (s *Session) Save() error {
-	return nil
+	if err := s.writeManifest(); err != nil {
+		return errors.Wrap(err, "writing manifest")
+	}
+	return errors.Wrap(s.saved(), "writing metadata")
 }
 
-// SpawnFrom spawns a new client based on an OSC message.
+// SpawnFrom launches a new client based on an OSC message.
+// The first argument of the message is the client's executable,
+// and it can be followed by launch options (see ParseLaunchOption).
+// The client is given a new ID, and is named after its executable until it announces itself.
 // We don't actually add the client to our client map until it announces itself successfully.
-// This method returns the cmd name and nil or the empty string and an error.
-func (s *Session) SpawnFrom(msg osc.Message, local net.Conn) (string, error) {
-	if len(msg.Arguments) != 2 {
-		return "", errors.New("add expects 2 arguments")
+// This method returns the manifest entry and pid of the new client,
+// and the pid can be passed to WaitAnnounce to wait for the client to announce itself.
+// Note that the client is not added to the manifest until it is passed to Record.
+func (s *Session) SpawnFrom(msg osc.Message, local net.Conn, g Goer) (ManifestEntry, Pid, error) {
+	if min, got := 1, len(msg.Arguments); got < min {
+		return ManifestEntry{}, 0, errors.Errorf("expected at least %d argument, got %d", min, got)
 	}
-
-	// Get the arguments.
-	cmdname, err := msg.Arguments[0].ReadString()
+	progname, err := msg.Arguments[0].ReadString()
 	if err != nil {
-		return "", errors.Wrap(err, "could not read cmdname")
+		return ManifestEntry{}, 0, errors.Wrap(err, "could not read progname")
 	}
-	progname, err := msg.Arguments[1].ReadString()
-	if err != nil {
-		return "", errors.Wrap(err, "could not read progname")
+	entry := ManifestEntry{
+		Name:       filepath.Base(progname),
+		Executable: progname,
+		ID:         s.newClientID(),
+	}
+	for i, arg := range msg.Arguments[1:] {
+		opt, err := arg.ReadString()
+		if err != nil {
+			return ManifestEntry{}, 0, errors.Wrapf(err, "could not read argument %d", i+1)
+		}
+		if err := entry.ParseLaunchOption(opt); err != nil {
+			return ManifestEntry{}, 0, err
+		}
 	}
 
 	// Exec the new client.
-	var (
-		cmd       = exec.Command(progname)
-		localAddr = local.LocalAddr().String()
-	)
-	cmd.Env = append(os.Environ(), "NSM_URL="+localAddr)
-
-	if err := s.cmdgrp.AddCmd(cmdname, cmd); err != nil {
-		return "", errors.Wrap(err, "adding command "+progname)
+	if err := entry.Validate(); err != nil {
+		return ManifestEntry{}, 0, errors.Wrap(err, "validating client")
 	}
+	pid, err := s.Launch(entry, local, g)
+	if err != nil {
+		return ManifestEntry{}, 0, err
+	}
+	return entry, pid, nil
+}
 
-	// Create a new entry in the session clients map.
-	s.sessionClientsMutex.Lock()
-	s.sessionClients[filepath.Join(s.Path, cmdname)] = &sessionClient{}
-	s.sessionClientsMutex.Unlock()
+// WaitAnnounce waits for a client that was started with Launch to announce itself.
+func (s *Session) WaitAnnounce(pid Pid, timeout time.Duration) (*Client, error) {
+	s.pendingMutex.Lock()
+	announced, ok := s.pending[pid]
+	s.pendingMutex.Unlock()
 
-	return cmdname, nil
+	if !ok {
+		return nil, errors.Errorf("no client launched with pid %d", pid)
+	}
+	defer func() {
+		s.pendingMutex.Lock()
+		delete(s.pending, pid)
+		s.pendingMutex.Unlock()
+	}()
+
+	select {
+	case <-time.After(timeout):
+		return nil, errors.Errorf("timeout waiting for pid %d to announce", pid)
+	case client := <-announced:
+		return client, nil
+	}
 }
 
 // clientFromAnnounce initializes a client from an announce message.
@@ -243,7 +644,7 @@ func (s *Session) clientFromAnnounce(msg osc.Message) (*Client, Pid, error) {
 		return nil, 0, errors.New("expected 6 arguments in announce message")
 	}
 
-	client := &Client{}
+	client := &Client{Addr: msg.Sender}
 
 	appname, err := msg.Arguments[0].ReadString()
 	if err != nil {
@@ -279,7 +680,9 @@ func (s *Session) clientFromAnnounce(msg osc.Message) (*Client, Pid, error) {
 	if err != nil {
 		return nil, 0, errors.Wrap(err, " read pid in announce message")
 	}
-	return client, Pid(pid), nil
+	client.Pid = Pid(pid)
+
+	return client, client.Pid, nil
 }
 
 // initializeDirectory initializes the session's directory.
@@ -295,6 +698,13 @@ func (s *Session) initializeDirectory() error {
 
 const dirPerms = 0755
 
+// isMetaDir returns true if the name is one of the directories at the top of a session's directory
+// where gonzo keeps the output, snapshots and history of the session,
+// which are not part of the session's contents.
+func isMetaDir(name string) bool {
+	return name == logsDirname || name == snapshotsDirname || name == gitDirname
+}
+
 // openOrCreateDir opens a directory with the provided path,
 // and creates it if it doesn't exist
 func openOrCreateDir(dirpath string) (*os.File, error) {
@@ -315,31 +725,319 @@ func openOrCreateDir(dirpath string) (*os.File, error) {
 	return fd, nil
 }
 
-// pipeSync pipes an io.ReadCloser to a file and calls
-// Sync on the *os.File after every write.
-func (s *Session) pipeSync(fd *os.File, r io.ReadCloser) func() error {
+// createLogFiles creates the files where a client's stdout and stderr are stored.
+func (s *Session) createLogFiles(clientID string) (*os.File, *os.File, error) {
+	var (
+		logsPath   = filepath.Join(s.Path, logsDirname)
+		stdoutPath = filepath.Join(logsPath, clientID+stdoutExt)
+		stderrPath = filepath.Join(logsPath, clientID+stderrExt)
+	)
+	if _, err := openOrCreateDir(logsPath); err != nil {
+		return nil, nil, errors.Wrapf(err, "opening or creating %s", logsPath)
+	}
+	s.dbg.Debugf("client stdout path %s", stdoutPath)
+	s.dbg.Debugf("client stderr path %s", stderrPath)
+
+	stdoutFile, err := os.Create(stdoutPath)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "creating "+stdoutPath)
+	}
+	stderrFile, err := os.Create(stderrPath)
+	if err != nil {
+		_ = stdoutFile.Close() // Best effort.
+		return nil, nil, errors.Wrap(err, "creating "+stderrPath)
+	}
+	return stdoutFile, stderrFile, nil
+}
+
+// addLogFiles records the files where a client's stdout and stderr are stored.
+func (s *Session) addLogFiles(clientID, stdoutPath, stderrPath string) {
+	s.sessionClientsMutex.Lock()
+	if _, ok := s.sessionClients[clientID]; !ok {
+		s.sessionClients[clientID] = &sessionClient{}
+	}
+	s.sessionClients[clientID].stderrPath = stderrPath
+	s.sessionClients[clientID].stdoutPath = stdoutPath
+	s.sessionClientsMutex.Unlock()
+}
+
+// pipeSync pipes an io.ReadCloser to a log file,
+// which is synced after every write.
+// It returns when the reader is closed, which happens when the process exits.
+func (s *Session) pipeSync(fd *logFile, r io.ReadCloser) func() error {
 	return func() error {
+		buf := make([]byte, 256)
 		for {
-			buf := make([]byte, 256)
-			if _, err := r.Read(buf); err != nil {
-				if err == io.EOF {
-					break
+			n, err := r.Read(buf)
+			if n > 0 {
+				s.dbg.Debugf("writing %s to %s", string(buf[:n]), fd.Name())
+				if _, err := fd.Write(buf[:n]); err != nil {
+					return err
 				}
 			}
-			s.dbg.Debugf("writing %s to %s", string(buf), fd.Name())
-			if _, err := fd.Write(buf); err != nil {
-				return errors.Wrap(err, "writing to file")
+			if err != nil {
+				break
 			}
-			if err := fd.Sync(); err != nil {
-				return errors.Wrap(err, "syncing file")
+		}
+		return errors.Wrap(fd.Close(), "closing file")
+	}
+}
+
+// readManifest reads the session's manifest from disk.
+// A session without a manifest has no clients.
+func (s *Session) readManifest() error {
+	f := filepath.Join(s.Path, manifestFilename)
+	fd, err := os.Open(f)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "opening %s", f)
+	}
+	defer func() { _ = fd.Close() }() // Best effort.
+
+	m, err := ReadManifest(fd)
+	if err != nil {
+		return errors.Wrapf(err, "reading %s", f)
+	}
+	s.manifestMutex.Lock()
+	s.manifest = m
+	s.manifestMutex.Unlock()
+
+	return nil
+}
+
+// applyLaunchOptions adds the launch options in the session's state to its manifest.
+func (s *Session) applyLaunchOptions() {
+	s.stateMutex.RLock()
+	defer s.stateMutex.RUnlock()
+
+	s.manifestMutex.Lock()
+	defer s.manifestMutex.Unlock()
+
+	for i, entry := range s.manifest {
+		if state, ok := s.state.Clients[entry.ID]; ok {
+			s.manifest[i].LaunchOptions = state.LaunchOptions
+		}
+	}
+}
+
+// readState reads the session's state from disk.
+// A session without a state file has no state.
+func (s *Session) readState() error {
+	f := filepath.Join(s.Path, stateFilename)
+	fd, err := os.Open(f)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "opening %s", f)
+	}
+	defer func() { _ = fd.Close() }() // Best effort.
+
+	state, err := ReadSessionState(fd)
+	if err != nil {
+		return errors.Wrapf(err, "reading %s", f)
+	}
+	s.stateMutex.Lock()
+	s.state = state
+	s.stateMutex.Unlock()
+
+	return nil
+}
+
+// clientID returns the ID of the client with the provided pid.
+// Clients that were not launched by the session are given a new ID.
+func (s *Session) clientID(pid Pid) string {
+	s.procsMutex.RLock()
+	for clientID, p := range s.procs {
+		if Pid(p.Process.Pid) == pid {
+			s.procsMutex.RUnlock()
+			return clientID
+		}
+	}
+	s.procsMutex.RUnlock()
+
+	return s.newClientID()
+}
+
+// newClientID returns a client ID that is not used by the session.
+func (s *Session) newClientID() string {
+	for {
+		clientID := NewClientID()
+		if !s.hasClientID(clientID) {
+			return clientID
+		}
+	}
+}
+
+// hasClientID returns true if the provided client ID is used by the session, false otherwise.
+func (s *Session) hasClientID(clientID string) bool {
+	s.manifestMutex.RLock()
+	inManifest := s.manifest.Contains(clientID)
+	s.manifestMutex.RUnlock()
+
+	s.procsMutex.RLock()
+	_, running := s.procs[clientID]
+	s.procsMutex.RUnlock()
+
+	s.clientsMutex.RLock()
+	_, announced := s.clients[clientID]
+	s.clientsMutex.RUnlock()
+
+	return inManifest || running || announced
+}
+
+// process returns the running process for the client with the provided ID.
+func (s *Session) process(clientID string) (*process, error) {
+	s.procsMutex.RLock()
+	p, ok := s.procs[clientID]
+	s.procsMutex.RUnlock()
+
+	if !ok {
+		return nil, errors.New("client is not running: " + clientID)
+	}
+	return p, nil
+}
+
+// processes returns a copy of the map of running processes.
+func (s *Session) processes() map[string]*process {
+	procs := map[string]*process{}
+	s.procsMutex.RLock()
+	for clientID, p := range s.procs {
+		procs[clientID] = p
+	}
+	s.procsMutex.RUnlock()
+	return procs
+}
+
+// stopOrder returns the session's running processes grouped in the order they should be stopped.
+func (s *Session) stopOrder() []map[string]*process {
+	var (
+		groups = s.Manifest().Groups()
+		procs  = s.processes()
+		order  = []map[string]*process{procs}
+	)
+	// Processes are moved out of procs into their group,
+	// which leaves procs with the processes that are not in the manifest.
+	for i := len(groups) - 1; i >= 0; i-- {
+		group := map[string]*process{}
+		for _, entry := range groups[i] {
+			if p, ok := procs[entry.ID]; ok {
+				group[entry.ID] = p
+				delete(procs, entry.ID)
 			}
 		}
-		return nil
+		order = append(order, group)
+	}
+	return order
+}
+
+// start execs the client described by a manifest entry.
+func (s *Session) start(entry ManifestEntry, local net.Conn) (*process, error) {
+	cmd := exec.Command(entry.Executable, entry.Args...)
+	cmd.Dir = entry.Dir
+
+	// The client's own environment variables take precedence over gonzo's,
+	// except for NSM_URL which always points to gonzo.
+	cmd.Env = append(os.Environ(), entry.Env...)
+	cmd.Env = append(cmd.Env, nsm.NsmURL+"="+NsmURL(local.LocalAddr()))
+
+	s.procsMutex.Lock()
+	defer s.procsMutex.Unlock()
+
+	if _, ok := s.procs[entry.ID]; ok {
+		return nil, errors.New("client is already running: " + entry.ID)
+	}
+	p, err := startProcess(cmd)
+	if err != nil {
+		return nil, errors.Wrap(err, "starting "+entry.Executable)
+	}
+	p.setOwner(s, entry.ID)
+	s.procs[entry.ID] = p
+
+	// Register the pending announcement before releasing the lock on procs,
+	// since Announce can not identify the client until then.
+	s.pendingMutex.Lock()
+	s.pending[Pid(p.Process.Pid)] = make(chan *Client, 1)
+	s.pendingMutex.Unlock()
+
+	// Create a new entry in the session clients map.
+	s.launched(entry.ID, p)
+
+	return p, nil
+}
+
+// updateClient updates the client with the provided address,
+// which must have the provided capability.
+// It returns a copy of the updated client.
+func (s *Session) updateClient(addr net.Addr, capability nsm.Capability, update func(*Client)) (Client, error) {
+	s.clientsMutex.Lock()
+	defer s.clientsMutex.Unlock()
+
+	for _, c := range s.clients {
+		if c.Addr.String() != addr.String() {
+			continue
+		}
+		if !c.HasCapability(capability) {
+			return Client{}, errors.Errorf("client %s does not have the %s capability", c.ID, capability)
+		}
+		update(c)
+		return *c, nil
+	}
+	return Client{}, errors.New("no client with address " + addr.String())
+}
+
+// exited records the exit status of a client's process and removes it from the session.
+// If the process was not stopped by gonzo then the session's supervisor is notified.
+func (s *Session) exited(clientID string, p *process) {
+	status := p.exitStatus()
+	s.dbg.Debugf("client %s exited: %s", clientID, status)
+
+	s.procsMutex.Lock()
+	if s.procs[clientID] == p {
+		delete(s.procs, clientID)
 	}
+	s.procsMutex.Unlock()
+
+	s.clientsMutex.Lock()
+	if c, ok := s.clients[clientID]; ok && c.Pid == Pid(p.Process.Pid) {
+		delete(s.clients, clientID)
+	}
+	s.clientsMutex.Unlock()
+
+	stopped := p.stoppedByGonzo()
+	s.exitLifecycle(clientID, p, stopped)
+
+	if stopped || s.sup == nil {
+		return
+	}
+	exit := ClientExit{Code: p.exitCode(), Status: status}
+
+	stderr, err := lastLines(p.stderrLog.Name(), crashLogLines)
+	if err != nil {
+		s.dbg.Debugf("reading stderr of client %s: %s", clientID, err)
+	}
+	exit.Stderr = stderr
+
+	s.sup.ClientExited(s, clientID, exit)
+}
+
+// writeManifest writes the session's manifest to disk.
+func (s *Session) writeManifest() error {
+	return writeFileAtomic(filepath.Join(s.Path, manifestFilename), s.Manifest())
+}
+
+// writeState writes the session's state to disk.
+func (s *Session) writeState() error {
+	s.stateMutex.RLock()
+	defer s.stateMutex.RUnlock()
+
+	return writeFileAtomic(filepath.Join(s.Path, stateFilename), s.state)
 }
 
 // linesToMessage converts lines from the provided io.Reader to an OSC message.
-func (s *Session) linesToMessage(r io.Reader, clientName string) (osc.Message, error) {
+func (s *Session) linesToMessage(r io.Reader, clientID string) (osc.Message, error) {
 	var (
 		br    = bufio.NewScanner(r)
 		lines = []string{}
@@ -347,13 +1045,13 @@ func (s *Session) linesToMessage(r io.Reader, clientName string) (osc.Message, e
 			Address: nsm.AddressReply,
 			Arguments: osc.Arguments{
 				osc.String(nsm.AddressClientLogs),
-				osc.String(clientName),
+				osc.String(clientID),
 			},
 		}
 	)
 	for br.Scan() {
 		txt := strings.TrimSpace(strings.Trim(br.Text(), "\x00"))
-		s.dbg.Debug("got output " + txt + " for client " + clientName)
+		s.dbg.Debug("got output " + txt + " for client " + clientID)
 		if len(txt) > 0 {
 			lines = append(lines, txt)
 		}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/scgolang/nsm"
+	"github.com/scgolang/osc"
+)
+
+// Addresses of the requests that read the history of the current session.
+const (
+	AddressSessionHistory  = "/gonzo/session/history"
+	AddressSessionDiff     = "/gonzo/session/diff"
+	AddressSessionCheckout = "/gonzo/session/checkout"
+)
+
+// errNoHistory is returned when the current session does not have a history.
+var errNoHistory = errors.New("session does not have a history, start gonzo with -history to keep one")
+
+// ListHistory replies with the saves in the history of the current session, newest first.
+// Each save is described by its commit, the time it was made formatted as RFC 3339,
+// and the first line of its commit message.
+func (app *App) ListHistory(msg osc.Message) error {
+	var reply osc.Message
+
+	history, err := app.history()
+	if err != nil {
+		reply = ReplyError(AddressSessionHistory, nsm.ErrGeneral, err.Error())
+	} else {
+		reply = osc.Message{
+			Address: nsm.AddressReply,
+			Arguments: osc.Arguments{
+				osc.String(AddressSessionHistory),
+				osc.Int(len(history)),
+			},
+		}
+		for _, entry := range history {
+			reply.Arguments = append(reply.Arguments, []osc.Argument{
+				osc.String(entry.Commit),
+				osc.String(entry.Time.Format(time.RFC3339)),
+				osc.String(entry.Message),
+			}...)
+		}
+	}
+	return errors.Wrapf(app.SendTo(msg.Sender, reply), "send %s reply", AddressSessionHistory)
+}
+
+// history returns the history of the current session.
+func (app *App) history() ([]HistoryEntry, error) {
+	sesh, err := app.sessions.Current()
+	if err != nil {
+		return nil, err
+	}
+	if !sesh.HasHistory() {
+		return nil, errNoHistory
+	}
+	return sesh.History()
+}
+
+// DiffHistory replies with the files that changed between two saves in the history of the current session.
+// Each file is described by a git status letter (e.g. A, D or M) and its path in the session's directory.
+func (app *App) DiffHistory(msg osc.Message) error {
+	var reply osc.Message
+
+	changes, err := app.diff(msg)
+	if err != nil {
+		reply = ReplyError(AddressSessionDiff, nsm.ErrGeneral, err.Error())
+	} else {
+		reply = osc.Message{
+			Address: nsm.AddressReply,
+			Arguments: osc.Arguments{
+				osc.String(AddressSessionDiff),
+				osc.Int(len(changes)),
+			},
+		}
+		for _, change := range changes {
+			reply.Arguments = append(reply.Arguments, []osc.Argument{
+				osc.String(change.Status),
+				osc.String(change.Path),
+			}...)
+		}
+	}
+	return errors.Wrapf(app.SendTo(msg.Sender, reply), "send %s reply", AddressSessionDiff)
+}
+
+// diff returns the files that changed between the two saves in a diff request.
+func (app *App) diff(msg osc.Message) ([]FileChange, error) {
+	if expected, got := 2, len(msg.Arguments); expected != got {
+		return nil, errors.Errorf("expected %d arguments, got %d", expected, got)
+	}
+	from, err := msg.Arguments[0].ReadString()
+	if err != nil {
+		return nil, errors.Wrap(err, "reading first commit")
+	}
+	to, err := msg.Arguments[1].ReadString()
+	if err != nil {
+		return nil, errors.Wrap(err, "reading second commit")
+	}
+	sesh, err := app.sessions.Current()
+	if err != nil {
+		return nil, err
+	}
+	if !sesh.HasHistory() {
+		return nil, errNoHistory
+	}
+	return sesh.Diff(from, to)
+}
+
+// CheckoutHistory creates a new session from a save in the history of the current session.
+// The new session is not opened.
+func (app *App) CheckoutHistory(msg osc.Message) (string, nsm.Error) {
+	app.sessionMutex.Lock()
+	defer app.sessionMutex.Unlock()
+
+	if expected, got := 2, len(msg.Arguments); expected != got {
+		return "", nsm.NewError(nsm.ErrGeneral, fmt.Sprintf("expected %d arguments, got %d", expected, got))
+	}
+	commit, err := msg.Arguments[0].ReadString()
+	if err != nil {
+		return "", nsm.NewError(nsm.ErrGeneral, "reading commit")
+	}
+	name, err := msg.Arguments[1].ReadString()
+	if err != nil {
+		return "", nsm.NewError(nsm.ErrGeneral, "reading session name")
+	}
+	sesh, err := app.sessions.Current()
+	if err != nil {
+		return "", nsm.NewError(nsm.ErrNoSessionOpen, err.Error())
+	}
+	if !sesh.HasHistory() {
+		return "", nsm.NewError(nsm.ErrGeneral, errNoHistory.Error())
+	}
+	if err := app.sessions.Checkout(sesh, commit, name); err != nil {
+		return "", nsm.NewError(nsm.ErrCreateFailed, err.Error())
+	}
+	return "checked out " + commit + " of session " + sesh.Name() + " as " + name, nil
+}
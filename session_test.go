@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+)
+
+func TestStopOrder(t *testing.T) {
+	sesh := &Session{
+		manifest: Manifest{
+			{Executable: "a", ID: "n1", LaunchOptions: LaunchOptions{Group: 1}},
+			{Executable: "b", ID: "n2"},
+			{Executable: "c", ID: "n3", LaunchOptions: LaunchOptions{Group: 1}},
+			{Executable: "d", ID: "n4"},
+			{Executable: "e", ID: "n5", LaunchOptions: LaunchOptions{Group: 2}},
+		},
+		// n4 is not running, and n6 and n7 are not in the manifest.
+		procs: map[string]*process{},
+	}
+	for _, clientID := range []string{"n1", "n2", "n3", "n5", "n6", "n7"} {
+		sesh.procs[clientID] = &process{}
+	}
+	ids := [][]string{}
+	for _, procs := range sesh.stopOrder() {
+		groupIDs := []string{}
+		for clientID, p := range procs {
+			if p != sesh.procs[clientID] {
+				t.Fatalf("expected the process of client %s", clientID)
+			}
+			groupIDs = append(groupIDs, clientID)
+		}
+		sort.Strings(groupIDs)
+		ids = append(ids, groupIDs)
+	}
+	// Processes that are not in the manifest are stopped first,
+	// followed by the launch groups in reverse order.
+	if expected, got := "[[n6 n7] [n5] [n1 n3] [n2]]", fmt.Sprint(ids); expected != got {
+		t.Fatalf("expected stop order %s, got %s", expected, got)
+	}
+}
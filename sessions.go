@@ -5,34 +5,43 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/scgolang/nsm"
 	"github.com/scgolang/osc"
 )
 
+const cachePerms = 0644
+
 // Sessions maintains a collection of sessions.
 type Sessions struct {
-	Home string // Home is the path to the directory that contains all the sessions.
-	Dir  *os.File
-	Curr string
-	Mu   sync.RWMutex
-	M    map[string]*Session
+	Home      string // Home is the path to the directory that contains all the sessions.
+	Templates string // Templates is the path to the directory that contains the session templates.
+	Dir       *os.File
+	Curr      string
+	Mu        sync.RWMutex
+	M         map[string]*Session
 
 	ctx context.Context
 	dbg Debugger
+	sup Supervisor
 }
 
 // NewSessions creates a new sessions collection.
-func NewSessions(ctx context.Context, dbg Debugger, home string) (*Sessions, error) {
+// The supervisor is notified when the clients of any of the sessions exit.
+func NewSessions(ctx context.Context, dbg Debugger, sup Supervisor, home, templates string) (*Sessions, error) {
 	s := &Sessions{
-		Home: home,
-		M:    map[string]*Session{},
+		Home:      home,
+		Templates: templates,
+		M:         map[string]*Session{},
 
 		ctx: ctx,
 		dbg: dbg,
+		sup: sup,
 	}
 	// Open the home dir.
 	if err := s.OpenHome(); err != nil {
@@ -49,16 +58,24 @@ func NewSessions(ctx context.Context, dbg Debugger, home string) (*Sessions, err
 	return s, nil
 }
 
+// ErrNoSessionOpen is returned when there is no current session.
+var ErrNoSessionOpen = errors.New("no session open")
+
 // Current returns the current session.
-// There should always be a current session.
-func (s *Sessions) Current() *Session {
+// ErrNoSessionOpen is returned if there is no current session.
+func (s *Sessions) Current() (*Session, error) {
 	s.Mu.RLock()
-	curr := s.M[s.Curr]
+	curr, ok := s.M[s.Curr]
 	s.Mu.RUnlock()
-	return curr
+
+	if !ok {
+		return nil, ErrNoSessionOpen
+	}
+	return curr, nil
 }
 
 // ListMessage creates an osc message that represents the sessions list.
+// Sessions are sorted by name.
 func (s *Sessions) ListMessage() osc.Message {
 	s.Mu.RLock()
 	msg := osc.Message{
@@ -68,17 +85,21 @@ func (s *Sessions) ListMessage() osc.Message {
 			osc.Int(len(s.M)),
 		},
 	}
+	names := make([]string, 0, len(s.M))
+	for name := range s.M {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
 	var (
-		i            = 0
 		curridx      = 0
 		sessionNames = []osc.Argument{}
 	)
-	for name := range s.M {
+	for i, name := range names {
 		if name == s.Curr {
 			curridx = i
 		}
 		sessionNames = append(sessionNames, osc.String(name))
-		i++
 	}
 	s.Mu.RUnlock()
 	msg.Arguments = append(msg.Arguments, osc.Int(curridx))
@@ -88,21 +109,92 @@ func (s *Sessions) ListMessage() osc.Message {
 
 // New creates a new session and makes it the current session.
 func (s *Sessions) New(name string) error {
+	if err := s.CheckNew(name); err != nil {
+		return err
+	}
 	f := filepath.Join(s.Home, name)
 
-	// Return an error if the session already exists.
-	s.Mu.RLock()
-	if _, ok := s.M[f]; ok {
-		s.Mu.RUnlock()
-		return errors.Errorf("session already present %s", f)
+	// Create the new session and add it to the map.
+	sesh, err := NewSession(s.ctx, s.dbg, s.sup, f)
+	if err != nil {
+		return errors.Wrapf(err, "could not open session %s", f)
 	}
+	if err := sesh.created(); err != nil {
+		return errors.Wrapf(err, "writing metadata for %s", f)
+	}
+	s.Mu.Lock()
+	s.M[f] = sesh
+	s.Mu.Unlock()
+
+	return nil
+}
+
+// Get returns the named session.
+func (s *Sessions) Get(name string) (*Session, error) {
+	if err := s.Read(); err != nil {
+		return nil, errors.Wrap(err, "reading sessions")
+	}
+	f := filepath.Join(s.Home, name)
+
+	s.Mu.RLock()
+	sesh, exists := s.M[f]
 	s.Mu.RUnlock()
 
-	// Create the new session and add it to the map.
-	sesh, err := NewSession(s.ctx, s.dbg, f)
+	if !exists {
+		return nil, errors.New("session " + f + " does not exist")
+	}
+	return sesh, nil
+}
+
+// Open makes the named session the current session.
+// The current session should be closed before calling Open.
+// Note that Open does not launch any of the session's clients.
+func (s *Sessions) Open(name string) error {
+	sesh, err := s.Get(name)
+	if err != nil {
+		return err
+	}
+	if err := sesh.opened(); err != nil {
+		return errors.Wrapf(err, "writing metadata for %s", sesh.Path)
+	}
+	s.Mu.Lock()
+	s.Curr = sesh.Path
+	s.Mu.Unlock()
+
+	return errors.Wrap(s.writeCurrent(), "caching current session")
+}
+
+// Duplicate copies a session's directory to a new session with the provided name,
+// leaving out the output, snapshots and history of the session.
+// Paths in the launch options that point into the session are rewritten to point into the copy.
+// Note that Duplicate does not make the new session the current session.
+func (s *Sessions) Duplicate(src *Session, name string) error {
+	if err := validateSessionName(name); err != nil {
+		return err
+	}
+	f := filepath.Join(s.Home, name)
+
+	if _, err := os.Stat(f); err == nil {
+		return errors.Errorf("session already present %s", f)
+	} else if !os.IsNotExist(err) {
+		return errors.Wrapf(err, "checking for %s", f)
+	}
+	if err := copySessionDir(src.Path, f); err != nil {
+		return errors.Wrapf(err, "copying %s to %s", src.Path, f)
+	}
+	if err := rewriteStatePaths(f, src.Path, f); err != nil {
+		return errors.Wrap(err, "rewriting paths")
+	}
+	sesh, err := NewSession(s.ctx, s.dbg, s.sup, f)
 	if err != nil {
 		return errors.Wrapf(err, "could not open session %s", f)
 	}
+	if err := sesh.Save(); err != nil {
+		return errors.Wrapf(err, "rewriting manifest for %s", f)
+	}
+	if err := sesh.created(); err != nil {
+		return errors.Wrapf(err, "writing metadata for %s", f)
+	}
 	s.Mu.Lock()
 	s.M[f] = sesh
 	s.Mu.Unlock()
@@ -110,10 +202,21 @@ func (s *Sessions) New(name string) error {
 	return nil
 }
 
-// Close closes all the sessions.
-func (s *Sessions) Close() error {
-	// Write the current session.
-	return nil
+// Close closes the current session, leaving no current session.
+// Clients that have not exited after the grace period are killed.
+func (s *Sessions) Close(grace time.Duration) error {
+	curr, err := s.Current()
+	if err != nil {
+		return err
+	}
+	if err := curr.Close(grace); err != nil {
+		return errors.Wrap(err, "closing session "+curr.Name())
+	}
+	s.Mu.Lock()
+	s.Curr = ""
+	s.Mu.Unlock()
+
+	return errors.Wrap(s.writeCurrent(), "caching current session")
 }
 
 // OpenHome tries to open the sessions home directory, creating it if it doesn't exist.
@@ -127,12 +230,14 @@ func (s *Sessions) OpenHome() error {
 }
 
 // Read reads sessions into memory.
+// Sessions that have already been read are kept as they are,
+// since they may have running clients.
 func (s *Sessions) Read() error {
 	if err := s.OpenHome(); err != nil {
 		return errors.Wrap(err, "opening session home directory")
 	}
 	// Read sessions and exit if there are none.
-	files, err := s.Dir.Readdirnames(-1)
+	files, err := s.Dir.Readdir(-1)
 	if err != nil {
 		return errors.Wrap(err, "reading directory contents")
 	}
@@ -142,14 +247,26 @@ func (s *Sessions) Read() error {
 
 	m := map[string]*Session{}
 
-	for _, filename := range files {
-		f := filepath.Join(s.Home, filename)
-		sesh, err := NewSession(s.ctx, s.dbg, f)
+	s.Mu.RLock()
+	for _, fi := range files {
+		// Hidden files (e.g. the current session cache) are not sessions.
+		if !fi.IsDir() || strings.HasPrefix(fi.Name(), ".") {
+			continue
+		}
+		f := filepath.Join(s.Home, fi.Name())
+		if sesh, ok := s.M[f]; ok {
+			m[f] = sesh
+			continue
+		}
+		sesh, err := NewSession(s.ctx, s.dbg, s.sup, f)
 		if err != nil {
-			return errors.Wrapf(err, "reading %s", filename)
+			s.Mu.RUnlock()
+			return errors.Wrapf(err, "reading %s", fi.Name())
 		}
 		m[f] = sesh
 	}
+	s.Mu.RUnlock()
+
 	s.Mu.Lock()
 	s.M = m
 	s.Mu.Unlock()
@@ -175,6 +292,13 @@ func (s *Sessions) Remove(name string) error {
 	if sesh.Dirty() {
 		return errors.New("session " + sessionPath + " has unsaved changes")
 	}
+	s.Mu.RLock()
+	isOpen := sessionPath == s.Curr
+	s.Mu.RUnlock()
+
+	if isOpen {
+		return errors.New("session " + sessionPath + " is open")
+	}
 	if err := os.RemoveAll(sessionPath); err != nil {
 		return errors.Wrap(err, "removing "+sessionPath)
 	}
@@ -182,10 +306,6 @@ func (s *Sessions) Remove(name string) error {
 	delete(s.M, sessionPath)
 	s.Mu.Unlock()
 
-	// If the removed session was the current session we need a new current session.
-	if sessionPath == s.Curr {
-		s.SelectCurrentRandomly()
-	}
 	return nil
 }
 
@@ -206,6 +326,10 @@ func (s *Sessions) SelectCurrent() error {
 	}
 	curr := strings.TrimSpace(string(contents))
 
+	// The cache is empty if there was no session open.
+	if curr == "" {
+		return nil
+	}
 	s.Mu.RLock()
 	if _, ok := s.M[curr]; !ok {
 		s.Mu.RUnlock()
@@ -230,3 +354,38 @@ func (s *Sessions) SelectCurrentRandomly() error {
 	s.Mu.RUnlock()
 	return nil
 }
+
+// CheckNew returns an error if a new session with the provided name can not be created,
+// either because the name is invalid or because the session already exists.
+func (s *Sessions) CheckNew(name string) error {
+	if err := validateSessionName(name); err != nil {
+		return err
+	}
+	f := filepath.Join(s.Home, name)
+
+	if _, err := os.Stat(f); err == nil {
+		return errors.Errorf("session already present %s", f)
+	} else if !os.IsNotExist(err) {
+		return errors.Wrapf(err, "checking for %s", f)
+	}
+	return nil
+}
+
+// validateSessionName returns an error if the name can not be used for a new session.
+func validateSessionName(name string) error {
+	if name == "" || strings.HasPrefix(name, ".") || strings.ContainsRune(name, filepath.Separator) {
+		return errors.Errorf("invalid session name %q", name)
+	}
+	return nil
+}
+
+// writeCurrent caches the current session so that it is selected the next time gonzo starts.
+func (s *Sessions) writeCurrent() error {
+	f := filepath.Join(s.Home, currentSessionCache)
+
+	s.Mu.RLock()
+	curr := s.Curr
+	s.Mu.RUnlock()
+
+	return errors.Wrapf(ioutil.WriteFile(f, []byte(curr), cachePerms), "writing %s", f)
+}
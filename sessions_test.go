@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestLaunchOptions writes the state of a session with one client,
+// whose launch options point into the client's directory.
+func writeTestLaunchOptions(t *testing.T, sesh *Session, clientID string) {
+	t.Helper()
+
+	clientDir := filepath.Join(sesh.Path, "fake."+clientID)
+	state := SessionState{Clients: map[string]ClientState{
+		clientID: {LaunchOptions: LaunchOptions{
+			Dir:  clientDir,
+			Args: []string{"-config", filepath.Join(clientDir, "config.txt")},
+			Env:  []string{"FAKE_HOME=" + clientDir},
+		}},
+	}}
+	writeTestFile(t, filepath.Join(clientDir, "config.txt"), "config")
+
+	if err := writeFileAtomic(filepath.Join(sesh.Path, stateFilename), state); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkTestLaunchOptions checks that the launch options written by writeTestLaunchOptions
+// point into the session in dir.
+func checkTestLaunchOptions(t *testing.T, dir, clientID string) {
+	t.Helper()
+
+	fd, err := os.Open(filepath.Join(dir, stateFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = fd.Close() }() // Best effort.
+
+	state, err := ReadSessionState(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		opts      = state.Clients[clientID].LaunchOptions
+		clientDir = filepath.Join(dir, "fake."+clientID)
+	)
+	if expected, got := clientDir, opts.Dir; expected != got {
+		t.Fatalf("expected dir %s, got %s", expected, got)
+	}
+	if expected, got := filepath.Join(clientDir, "config.txt"), opts.Args[1]; expected != got {
+		t.Fatalf("expected argument %s, got %s", expected, got)
+	}
+	if expected, got := "FAKE_HOME="+clientDir, opts.Env[0]; expected != got {
+		t.Fatalf("expected environment %s, got %s", expected, got)
+	}
+}
+
+func TestDuplicate(t *testing.T) {
+	s := newTestSessions(t)
+
+	if err := s.New("song"); err != nil {
+		t.Fatal(err)
+	}
+	src, err := s.Get("song")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestLaunchOptions(t, src, "n1")
+	writeTestFile(t, filepath.Join(src.Path, logsDirname, "n1.stdout"), "output")
+
+	if err := s.Duplicate(src, "copy"); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(s.Home, "copy")
+
+	checkTestLaunchOptions(t, dst, "n1")
+	checkTestLaunchOptions(t, src.Path, "n1")
+
+	if expected, got := "config", readTestFile(t, filepath.Join(dst, "fake.n1", "config.txt")); expected != got {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+	if _, err := os.Stat(filepath.Join(dst, logsDirname)); !os.IsNotExist(err) {
+		t.Fatalf("expected client output to be left out of the copy, got %v", err)
+	}
+	if err := s.Duplicate(src, "copy"); err == nil {
+		t.Fatal("expected an error when the session already exists")
+	}
+}
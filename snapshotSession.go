@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/scgolang/nsm"
+	"github.com/scgolang/osc"
+)
+
+// Addresses of the requests that manage snapshots of the current session.
+const (
+	AddressSessionSnapshot       = "/gonzo/session/snapshot"
+	AddressSessionListSnapshots  = "/gonzo/session/list_snapshots"
+	AddressSessionRestore        = "/gonzo/session/restore"
+	AddressSessionDeleteSnapshot = "/gonzo/session/delete_snapshot"
+)
+
+// SnapshotSession tells every client in the current session to save,
+// then captures the session's directory in a snapshot with an optional label.
+func (app *App) SnapshotSession(msg osc.Message) (string, nsm.Error) {
+	if max, got := 1, len(msg.Arguments); got > max {
+		return "", nsm.NewError(nsm.ErrGeneral, fmt.Sprintf("expected at most %d argument, got %d", max, got))
+	}
+	var label string
+	if len(msg.Arguments) > 0 {
+		l, err := msg.Arguments[0].ReadString()
+		if err != nil {
+			return "", nsm.NewError(nsm.ErrGeneral, "reading label")
+		}
+		label = l
+	}
+	sesh, err := app.sessions.Current()
+	if err != nil {
+		return "", nsm.NewError(nsm.ErrNoSessionOpen, err.Error())
+	}
+	failed, err := app.saveSession(sesh)
+	if err != nil {
+		return "", nsm.NewError(nsm.ErrGeneral, err.Error())
+	}
+	snap, err := sesh.Snapshot(label)
+	if err != nil {
+		return "", nsm.NewError(nsm.ErrGeneral, err.Error())
+	}
+	app.Debugf("took snapshot %s of session %s", snap.ID, sesh.Name())
+
+	if len(failed) > 0 {
+		return "took snapshot " + snap.ID + " of session " + sesh.Name() + " but these clients failed to save: " + strings.Join(failed, ", "), nil
+	}
+	return "took snapshot " + snap.ID + " of session " + sesh.Name(), nil
+}
+
+// ListSnapshots replies with the snapshots of the current session, oldest first.
+// Each snapshot is described by its ID, its label, and the time it was taken formatted as RFC 3339.
+func (app *App) ListSnapshots(msg osc.Message) error {
+	var reply osc.Message
+
+	snaps, err := app.snapshots()
+	if err != nil {
+		reply = ReplyError(AddressSessionListSnapshots, nsm.ErrGeneral, err.Error())
+	} else {
+		reply = osc.Message{
+			Address: nsm.AddressReply,
+			Arguments: osc.Arguments{
+				osc.String(AddressSessionListSnapshots),
+				osc.Int(len(snaps)),
+			},
+		}
+		for _, snap := range snaps {
+			reply.Arguments = append(reply.Arguments, []osc.Argument{
+				osc.String(snap.ID),
+				osc.String(snap.Label),
+				osc.String(snap.Created.Format(time.RFC3339)),
+			}...)
+		}
+	}
+	return errors.Wrapf(app.SendTo(msg.Sender, reply), "send %s reply", AddressSessionListSnapshots)
+}
+
+// snapshots returns the snapshots of the current session.
+func (app *App) snapshots() ([]Snapshot, error) {
+	sesh, err := app.sessions.Current()
+	if err != nil {
+		return nil, err
+	}
+	return sesh.Snapshots()
+}
+
+// RestoreSnapshot closes the current session without saving, replaces its directory with a snapshot,
+// then reopens it and relaunches all of its clients.
+// If the session has unsaved changes then the snapshot is only restored if the force argument is provided.
+func (app *App) RestoreSnapshot(msg osc.Message) (string, nsm.Error) {
+	app.sessionMutex.Lock()
+	defer app.sessionMutex.Unlock()
+
+	if min, max, got := 1, 2, len(msg.Arguments); got < min || got > max {
+		return "", nsm.NewError(nsm.ErrGeneral, fmt.Sprintf("expected %d or %d arguments, got %d", min, max, got))
+	}
+	id, err := msg.Arguments[0].ReadString()
+	if err != nil {
+		return "", nsm.NewError(nsm.ErrGeneral, "reading snapshot ID")
+	}
+	force, err := ReadForce(msg, 1)
+	if err != nil {
+		return "", nsm.NewError(nsm.ErrGeneral, err.Error())
+	}
+	sesh, err := app.sessions.Current()
+	if err != nil {
+		return "", nsm.NewError(nsm.ErrNoSessionOpen, err.Error())
+	}
+	if _, err := sesh.ReadSnapshot(id); err != nil {
+		return "", nsm.NewError(nsm.ErrNoSuchFile, err.Error())
+	}
+	if sesh.Dirty() && !force {
+		return "", nsm.NewError(nsm.ErrUnsavedChanges, errUnsavedChanges.Error())
+	}
+	app.Debugf("restoring snapshot %s of session %s", id, sesh.Name())
+
+	if err := app.sessions.Close(app.GracePeriod); err != nil {
+		return "", nsm.NewError(nsm.ErrGeneral, err.Error())
+	}
+	snap, err := sesh.RestoreSnapshot(id)
+	if err != nil {
+		return "", nsm.NewError(nsm.ErrGeneral, err.Error())
+	}
+	if err := app.sessions.Open(sesh.Name()); err != nil {
+		return "", nsm.NewError(nsm.ErrGeneral, err.Error())
+	}
+	if failed := app.launchSession(sesh); len(failed) > 0 {
+		return "restored snapshot " + snap.ID + " of session " + sesh.Name() + " but these clients failed: " + strings.Join(failed, ", "), nil
+	}
+	return "restored snapshot " + snap.ID + " of session " + sesh.Name(), nil
+}
+
+// DeleteSnapshot deletes a snapshot of the current session.
+func (app *App) DeleteSnapshot(msg osc.Message) (string, nsm.Error) {
+	if expected, got := 1, len(msg.Arguments); expected != got {
+		return "", nsm.NewError(nsm.ErrGeneral, fmt.Sprintf("expected %d argument, got %d", expected, got))
+	}
+	id, err := msg.Arguments[0].ReadString()
+	if err != nil {
+		return "", nsm.NewError(nsm.ErrGeneral, "reading snapshot ID")
+	}
+	sesh, err := app.sessions.Current()
+	if err != nil {
+		return "", nsm.NewError(nsm.ErrNoSessionOpen, err.Error())
+	}
+	snap, err := sesh.DeleteSnapshot(id)
+	if err != nil {
+		return "", nsm.NewError(nsm.ErrGeneral, err.Error())
+	}
+	return "deleted snapshot " + snap.ID + " of session " + sesh.Name(), nil
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// snapshotsDirname is the name of the directory in a session's directory where snapshots are stored.
+// The contents of snapshotted files are stored once in snapshotObjectsDirname, named after their hash,
+// and each snapshot is a JSON index of the session's files named after the hash of the index.
+const (
+	snapshotsDirname       = ".snapshots"
+	snapshotObjectsDirname = "objects"
+	snapshotExt            = ".json"
+)
+
+// snapshotIDLength is the number of hex characters of the hash of a snapshot's index that are used as its ID.
+const snapshotIDLength = 12
+
+// Snapshot is a copy of a session's directory at a point in time.
+type Snapshot struct {
+	ID      string         `json:"-"`
+	Label   string         `json:"label"`
+	Created time.Time      `json:"created"`
+	Files   []SnapshotFile `json:"files"`
+}
+
+// SnapshotFile is a file, directory or symbolic link in a snapshot.
+type SnapshotFile struct {
+	// Path is relative to the session's directory, with forward slashes.
+	Path string      `json:"path"`
+	Mode os.FileMode `json:"mode"`
+
+	// Hash is the SHA-256 hash of the contents of a regular file.
+	Hash string `json:"hash,omitempty"`
+
+	// Link is the target of a symbolic link.
+	Link string `json:"link,omitempty"`
+}
+
+// Snapshot captures the session's directory, except for the logs of its clients, its snapshots, its history
+// and its metadata.
+// Files that have the same contents as a file in an earlier snapshot are not stored again.
+// If the label is empty then the snapshot is labelled with its ID.
+// Note that it is up to the caller to tell the session's clients to save.
+func (s *Session) Snapshot(label string) (Snapshot, error) {
+	objects := filepath.Join(s.Path, snapshotsDirname, snapshotObjectsDirname)
+	if err := os.MkdirAll(objects, dirPerms); err != nil {
+		return Snapshot{}, errors.Wrapf(err, "making directory %s", objects)
+	}
+	snap := Snapshot{
+		Label:   label,
+		Created: time.Now(),
+		Files:   []SnapshotFile{},
+	}
+	err := filepath.Walk(s.Path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == s.Path {
+			return nil
+		}
+		rel, err := filepath.Rel(s.Path, path)
+		if err != nil {
+			return errors.Wrapf(err, "getting relative path of %s", path)
+		}
+		if isMetaDir(rel) {
+			return filepath.SkipDir
+		}
+		if rel == metaFilename {
+			return nil
+		}
+		file := SnapshotFile{Path: filepath.ToSlash(rel), Mode: info.Mode()}
+
+		switch mode := info.Mode(); {
+		case mode.IsDir():
+		case mode&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return errors.Wrapf(err, "reading link %s", path)
+			}
+			file.Link = link
+		case mode.IsRegular():
+			hash, err := storeObject(objects, path)
+			if err != nil {
+				return errors.Wrapf(err, "storing %s", path)
+			}
+			file.Hash = hash
+		default:
+			// Skip sockets, pipes, devices, etc.
+			return nil
+		}
+		snap.Files = append(snap.Files, file)
+		return nil
+	})
+	if err != nil {
+		return Snapshot{}, errors.Wrap(err, "capturing session directory")
+	}
+	index, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return Snapshot{}, errors.Wrap(err, "encoding snapshot")
+	}
+	sum := sha256.Sum256(index)
+	snap.ID = hex.EncodeToString(sum[:])[:snapshotIDLength]
+
+	if snap.Label == "" {
+		snap.Label = snap.ID
+		if index, err = json.MarshalIndent(snap, "", "  "); err != nil {
+			return Snapshot{}, errors.Wrap(err, "encoding snapshot")
+		}
+	}
+	f := s.snapshotPath(snap.ID)
+	if err := ioutil.WriteFile(f, append(index, '\n'), cachePerms); err != nil {
+		return Snapshot{}, errors.Wrapf(err, "writing %s", f)
+	}
+	return snap, nil
+}
+
+// Snapshots returns the session's snapshots, oldest first.
+func (s *Session) Snapshots() ([]Snapshot, error) {
+	dir := filepath.Join(s.Path, snapshotsDirname)
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Snapshot{}, nil
+		}
+		return nil, errors.Wrapf(err, "reading %s", dir)
+	}
+	snaps := []Snapshot{}
+	for _, fi := range files {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), snapshotExt) {
+			continue
+		}
+		snap, err := s.ReadSnapshot(strings.TrimSuffix(fi.Name(), snapshotExt))
+		if err != nil {
+			return nil, err
+		}
+		snaps = append(snaps, snap)
+	}
+	sort.SliceStable(snaps, func(i, j int) bool {
+		return snaps[i].Created.Before(snaps[j].Created)
+	})
+	return snaps, nil
+}
+
+// RestoreSnapshot replaces the contents of the session's directory with a snapshot.
+// The logs of the session's clients, its snapshots, its history and its metadata are left untouched.
+// The session's manifest and state are read again after the files have been restored.
+// The session should be closed before calling RestoreSnapshot.
+func (s *Session) RestoreSnapshot(id string) (Snapshot, error) {
+	snap, err := s.ReadSnapshot(id)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	objects := filepath.Join(s.Path, snapshotsDirname, snapshotObjectsDirname)
+
+	// Make sure every file can be restored before removing anything.
+	// Each file must be restored into a directory that comes before it in the snapshot,
+	// so a file can not be written through a symbolic link that the snapshot restores.
+	dirs := map[string]bool{}
+	for _, file := range snap.Files {
+		if err := file.validate(); err != nil {
+			return Snapshot{}, errors.Wrap(err, "validating snapshot")
+		}
+		p := filepath.FromSlash(file.Path)
+		if parent := filepath.Dir(p); parent != "." && !dirs[parent] {
+			return Snapshot{}, errors.Errorf("validating snapshot: parent directory of %s is not in the snapshot", file.Path)
+		}
+		if file.Mode.IsDir() {
+			dirs[p] = true
+		}
+		if file.Hash == "" {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(objects, file.Hash)); err != nil {
+			return Snapshot{}, errors.Wrapf(err, "missing contents of %s", file.Path)
+		}
+	}
+	entries, err := ioutil.ReadDir(s.Path)
+	if err != nil {
+		return Snapshot{}, errors.Wrapf(err, "reading %s", s.Path)
+	}
+	for _, fi := range entries {
+		if isMetaDir(fi.Name()) || fi.Name() == metaFilename {
+			continue
+		}
+		f := filepath.Join(s.Path, fi.Name())
+		if err := os.RemoveAll(f); err != nil {
+			return Snapshot{}, errors.Wrapf(err, "removing %s", f)
+		}
+	}
+	// Parent directories come before their contents since the files were captured with filepath.Walk.
+	for _, file := range snap.Files {
+		target := filepath.Join(s.Path, filepath.FromSlash(file.Path))
+
+		if err := checkParentDirs(s.Path, target); err != nil {
+			return Snapshot{}, errors.Wrapf(err, "restoring %s", file.Path)
+		}
+		switch {
+		case file.Mode.IsDir():
+			err = os.Mkdir(target, file.Mode.Perm())
+		case file.Mode&os.ModeSymlink != 0:
+			err = os.Symlink(file.Link, target)
+		default:
+			err = copyFile(filepath.Join(objects, file.Hash), target, file.Mode.Perm())
+		}
+		if err != nil {
+			return Snapshot{}, errors.Wrapf(err, "restoring %s", file.Path)
+		}
+	}
+	return snap, errors.Wrap(s.reload(), "reloading session")
+}
+
+// DeleteSnapshot deletes one of the session's snapshots,
+// along with the contents of any files that are not in the session's other snapshots.
+func (s *Session) DeleteSnapshot(id string) (Snapshot, error) {
+	snap, err := s.ReadSnapshot(id)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	f := s.snapshotPath(id)
+	if err := os.Remove(f); err != nil {
+		return Snapshot{}, errors.Wrapf(err, "removing %s", f)
+	}
+	snaps, err := s.Snapshots()
+	if err != nil {
+		return snap, err
+	}
+	used := map[string]bool{}
+	for _, other := range snaps {
+		for _, file := range other.Files {
+			used[file.Hash] = true
+		}
+	}
+	for _, file := range snap.Files {
+		if file.Hash == "" || used[file.Hash] {
+			continue
+		}
+		obj := filepath.Join(s.Path, snapshotsDirname, snapshotObjectsDirname, file.Hash)
+		if err := os.Remove(obj); err != nil && !os.IsNotExist(err) {
+			return snap, errors.Wrapf(err, "removing %s", obj)
+		}
+	}
+	return snap, nil
+}
+
+// ReadSnapshot reads the snapshot with the provided ID.
+func (s *Session) ReadSnapshot(id string) (Snapshot, error) {
+	if id == "" || strings.ContainsAny(id, `/\.`) {
+		return Snapshot{}, errors.Errorf("invalid snapshot ID %q", id)
+	}
+	f := s.snapshotPath(id)
+
+	data, err := ioutil.ReadFile(f)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Snapshot{}, errors.New("snapshot does not exist: " + id)
+		}
+		return Snapshot{}, errors.Wrapf(err, "reading %s", f)
+	}
+	snap := Snapshot{}
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return Snapshot{}, errors.Wrapf(err, "decoding %s", f)
+	}
+	snap.ID = id
+	return snap, nil
+}
+
+// snapshotPath returns the path of the index of the snapshot with the provided ID.
+func (s *Session) snapshotPath(id string) string {
+	return filepath.Join(s.Path, snapshotsDirname, id+snapshotExt)
+}
+
+// reload reads the session's manifest, state and metadata from disk again, replacing the ones in memory.
+func (s *Session) reload() error {
+	s.manifestMutex.Lock()
+	s.manifest = Manifest{}
+	s.manifestMutex.Unlock()
+
+	s.stateMutex.Lock()
+	s.state = SessionState{Clients: map[string]ClientState{}}
+	s.stateMutex.Unlock()
+
+	s.metaMutex.Lock()
+	s.meta = SessionMeta{}
+	s.metaMutex.Unlock()
+
+	if err := s.readManifest(); err != nil {
+		return errors.Wrap(err, "reading manifest")
+	}
+	if err := s.readState(); err != nil {
+		return errors.Wrap(err, "reading state")
+	}
+	if err := s.readMeta(); err != nil {
+		return errors.Wrap(err, "reading metadata")
+	}
+	s.applyLaunchOptions()
+
+	return nil
+}
+
+// validate returns an error if the file can not be safely restored into a session's directory.
+func (file SnapshotFile) validate() error {
+	p := filepath.FromSlash(file.Path)
+	if p == "" || filepath.IsAbs(p) || p != filepath.Clean(p) || p == ".." || strings.HasPrefix(p, ".."+string(filepath.Separator)) {
+		return errors.Errorf("invalid path %q", file.Path)
+	}
+	if isMetaDir(strings.Split(file.Path, "/")[0]) || file.Path == metaFilename {
+		return errors.Errorf("invalid path %q", file.Path)
+	}
+	if file.Mode.IsRegular() && len(file.Hash) != sha256.Size*2 {
+		return errors.Errorf("invalid hash for %q", file.Path)
+	}
+	return nil
+}
+
+// checkParentDirs returns an error if any of the directories between root and the file f
+// is outside of root, or is not a directory, e.g. because it is a symbolic link.
+func checkParentDirs(root, f string) error {
+	rel, err := filepath.Rel(root, filepath.Dir(f))
+	if err != nil {
+		return errors.Wrapf(err, "%s is not in %s", f, root)
+	}
+	if rel == "." {
+		return nil
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return errors.Errorf("%s is not in %s", f, root)
+	}
+	dir := root
+	for _, name := range strings.Split(rel, string(filepath.Separator)) {
+		dir = filepath.Join(dir, name)
+
+		fi, err := os.Lstat(dir)
+		if err != nil {
+			return errors.Wrapf(err, "checking %s", dir)
+		}
+		if !fi.IsDir() {
+			return errors.Errorf("%s is not a directory", dir)
+		}
+	}
+	return nil
+}
+
+// storeObject stores the contents of a file in the objects directory of a session's snapshots,
+// named after the hex encoded SHA-256 hash of the contents, unless it is already there.
+// It returns the hash.
+func storeObject(objects, path string) (string, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return "", errors.Wrapf(err, "opening %s", path)
+	}
+	defer func() { _ = in.Close() }() // Best effort.
+
+	tmp, err := ioutil.TempFile(objects, ".tmp")
+	if err != nil {
+		return "", errors.Wrap(err, "creating temporary file")
+	}
+	h := sha256.New()
+
+	if _, err := io.Copy(io.MultiWriter(tmp, h), in); err != nil {
+		_ = tmp.Close()           // Best effort.
+		_ = os.Remove(tmp.Name()) // Best effort.
+		return "", errors.Wrapf(err, "copying %s", path)
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name()) // Best effort.
+		return "", errors.Wrapf(err, "closing %s", tmp.Name())
+	}
+	hash := hex.EncodeToString(h.Sum(nil))
+	obj := filepath.Join(objects, hash)
+
+	if _, err := os.Stat(obj); err == nil {
+		return hash, errors.Wrapf(os.Remove(tmp.Name()), "removing %s", tmp.Name())
+	}
+	if err := os.Chmod(tmp.Name(), cachePerms); err != nil {
+		_ = os.Remove(tmp.Name()) // Best effort.
+		return "", errors.Wrapf(err, "changing mode of %s", tmp.Name())
+	}
+	return hash, errors.Wrapf(os.Rename(tmp.Name(), obj), "renaming %s", tmp.Name())
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testDebugger logs debugging output to a test.
+type testDebugger struct {
+	t *testing.T
+}
+
+func (d testDebugger) Debug(msg string) {
+	d.t.Log(msg)
+}
+
+func (d testDebugger) Debugf(format string, args ...interface{}) {
+	d.t.Logf(format, args...)
+}
+
+// newTestSession creates a session in a temporary directory.
+func newTestSession(t *testing.T) *Session {
+	t.Helper()
+
+	sesh, err := NewSession(context.Background(), testDebugger{t}, nil, filepath.Join(t.TempDir(), "session"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sesh
+}
+
+// writeTestFile writes a file, creating its parent directories.
+func writeTestFile(t *testing.T, path, contents string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), dirPerms); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(contents), cachePerms); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readTestFile returns the contents of a file.
+func readTestFile(t *testing.T, path string) string {
+	t.Helper()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestSnapshotFileValidate(t *testing.T) {
+	hash := strings.Repeat("a", 64)
+
+	for _, testcase := range []struct {
+		name  string
+		file  SnapshotFile
+		valid bool
+	}{
+		{"regular file", SnapshotFile{Path: "fake.n1/data.txt", Mode: cachePerms, Hash: hash}, true},
+		{"directory", SnapshotFile{Path: "fake.n1", Mode: os.ModeDir | dirPerms}, true},
+		{"symbolic link", SnapshotFile{Path: "fake.n1/link", Mode: os.ModeSymlink | 0777, Link: "data.txt"}, true},
+		{"empty path", SnapshotFile{Path: "", Mode: os.ModeDir | dirPerms}, false},
+		{"absolute path", SnapshotFile{Path: "/etc/passwd", Mode: cachePerms, Hash: hash}, false},
+		{"parent directory", SnapshotFile{Path: "..", Mode: os.ModeDir | dirPerms}, false},
+		{"outside the session", SnapshotFile{Path: "../escape.txt", Mode: cachePerms, Hash: hash}, false},
+		{"traversal inside the path", SnapshotFile{Path: "fake.n1/../../escape.txt", Mode: cachePerms, Hash: hash}, false},
+		{"unclean path", SnapshotFile{Path: "fake.n1/./data.txt", Mode: cachePerms, Hash: hash}, false},
+		{"client output", SnapshotFile{Path: logsDirname + "/n1.stdout", Mode: cachePerms, Hash: hash}, false},
+		{"snapshots", SnapshotFile{Path: snapshotsDirname + "/objects/" + hash, Mode: cachePerms, Hash: hash}, false},
+		{"history", SnapshotFile{Path: gitDirname + "/hooks/post-commit", Mode: 0755, Hash: hash}, false},
+		{"metadata", SnapshotFile{Path: metaFilename, Mode: cachePerms, Hash: hash}, false},
+		{"missing hash", SnapshotFile{Path: "fake.n1/data.txt", Mode: cachePerms}, false},
+		{"short hash", SnapshotFile{Path: "fake.n1/data.txt", Mode: cachePerms, Hash: "abc"}, false},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			err := testcase.file.validate()
+			if testcase.valid && err != nil {
+				t.Fatalf("expected %q to be valid, got %s", testcase.file.Path, err)
+			}
+			if !testcase.valid && err == nil {
+				t.Fatalf("expected %q to be invalid", testcase.file.Path)
+			}
+		})
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	sesh := newTestSession(t)
+
+	var (
+		data   = filepath.Join(sesh.Path, "fake.n1", "data.txt")
+		nested = filepath.Join(sesh.Path, "fake.n1", "samples", "kick.wav")
+		extra  = filepath.Join(sesh.Path, "extra.txt")
+		output = filepath.Join(sesh.Path, logsDirname, "n1.stdout")
+	)
+	writeTestFile(t, data, "v1")
+	writeTestFile(t, nested, "kick")
+	writeTestFile(t, output, "output")
+
+	if err := os.Symlink("data.txt", filepath.Join(sesh.Path, "fake.n1", "link")); err != nil {
+		t.Fatal(err)
+	}
+	snap, err := sesh.Snapshot("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := "first", snap.Label; expected != got {
+		t.Fatalf("expected label %q, got %q", expected, got)
+	}
+	for _, file := range snap.Files {
+		if strings.HasPrefix(file.Path, logsDirname) || strings.HasPrefix(file.Path, snapshotsDirname) {
+			t.Fatalf("expected %s to be left out of the snapshot", file.Path)
+		}
+	}
+	// Change the session after the snapshot.
+	writeTestFile(t, data, "v2")
+	writeTestFile(t, extra, "extra")
+	writeTestFile(t, output, "more output")
+
+	if err := os.RemoveAll(filepath.Dir(nested)); err != nil {
+		t.Fatal(err)
+	}
+	if err := sesh.SetDescription("after the snapshot"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sesh.RestoreSnapshot(snap.ID); err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := "v1", readTestFile(t, data); expected != got {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+	if expected, got := "kick", readTestFile(t, nested); expected != got {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+	if _, err := os.Stat(extra); !os.IsNotExist(err) {
+		t.Fatalf("expected %s to be removed, got %v", extra, err)
+	}
+	link, err := os.Readlink(filepath.Join(sesh.Path, "fake.n1", "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := "data.txt", link; expected != got {
+		t.Fatalf("expected link to %q, got %q", expected, got)
+	}
+	// The output and metadata of the session are not part of its snapshots.
+	if expected, got := "more output", readTestFile(t, output); expected != got {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+	if expected, got := "after the snapshot", sesh.Meta().Description; expected != got {
+		t.Fatalf("expected description %q, got %q", expected, got)
+	}
+}
+
+func TestRestoreSnapshotRefusesTraversal(t *testing.T) {
+	for _, path := range []string{
+		"../escape.txt",
+		"fake.n1/../../escape.txt",
+		"/tmp/escape.txt",
+		gitDirname + "/hooks/post-checkout",
+	} {
+		t.Run(path, func(t *testing.T) {
+			sesh := newTestSession(t)
+			data := filepath.Join(sesh.Path, "fake.n1", "data.txt")
+			writeTestFile(t, data, "v1")
+
+			snap, err := sesh.Snapshot("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Tamper with the snapshot's index.
+			hash := snap.Files[len(snap.Files)-1].Hash
+			snap.Files = append(snap.Files, SnapshotFile{Path: path, Mode: cachePerms, Hash: hash})
+
+			index, err := json.Marshal(snap)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(sesh.snapshotPath(snap.ID), index, cachePerms); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := sesh.RestoreSnapshot(snap.ID); err == nil {
+				t.Fatal("expected an error")
+			}
+			// Nothing is removed if the snapshot is refused.
+			if expected, got := "v1", readTestFile(t, data); expected != got {
+				t.Fatalf("expected %q, got %q", expected, got)
+			}
+			if _, err := os.Stat(filepath.Join(filepath.Dir(sesh.Path), "escape.txt")); !os.IsNotExist(err) {
+				t.Fatalf("expected no file outside of the session, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRestoreSnapshotRefusesLinkedParents(t *testing.T) {
+	var (
+		sesh    = newTestSession(t)
+		outside = t.TempDir()
+		data    = filepath.Join(sesh.Path, "fake.n1", "data.txt")
+	)
+	writeTestFile(t, data, "v1")
+
+	snap, err := sesh.Snapshot("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Tamper with the snapshot's index, so a file is restored through a link to a directory outside of the session.
+	hash := snap.Files[len(snap.Files)-1].Hash
+	snap.Files = append(snap.Files,
+		SnapshotFile{Path: "a", Mode: os.ModeSymlink | 0777, Link: outside},
+		SnapshotFile{Path: "a/evil", Mode: cachePerms, Hash: hash},
+	)
+	index, err := json.Marshal(snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(sesh.snapshotPath(snap.ID), index, cachePerms); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sesh.RestoreSnapshot(snap.ID); err == nil {
+		t.Fatal("expected an error")
+	}
+	if expected, got := "v1", readTestFile(t, data); expected != got {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "evil")); !os.IsNotExist(err) {
+		t.Fatalf("expected no file outside of the session, got %v", err)
+	}
+}
+
+func TestCheckParentDirs(t *testing.T) {
+	var (
+		root    = t.TempDir()
+		outside = t.TempDir()
+	)
+	writeTestFile(t, filepath.Join(root, "dir", "file.txt"), "file")
+
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	for _, testcase := range []struct {
+		f     string
+		valid bool
+	}{
+		{filepath.Join(root, "file.txt"), true},
+		{filepath.Join(root, "dir", "new.txt"), true},
+		{filepath.Join(root, "link", "evil.txt"), false},
+		{filepath.Join(root, "dir", "file.txt", "evil.txt"), false},
+		{filepath.Join(root, "missing", "evil.txt"), false},
+		{filepath.Join(outside, "evil.txt"), false},
+		{filepath.Join(root, "..", "evil.txt"), false},
+	} {
+		err := checkParentDirs(root, testcase.f)
+		if testcase.valid && err != nil {
+			t.Fatalf("expected %s to be valid, got %s", testcase.f, err)
+		}
+		if !testcase.valid && err == nil {
+			t.Fatalf("expected %s to be invalid", testcase.f)
+		}
+	}
+}
+
+func TestReadSnapshotInvalidID(t *testing.T) {
+	sesh := newTestSession(t)
+
+	for _, id := range []string{"", "..", "../x", "a/b", `a\b`, "a.json"} {
+		if _, err := sesh.ReadSnapshot(id); err == nil {
+			t.Fatalf("expected an error for snapshot ID %q", id)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// stateFilename is the name of the file in a session's directory
+// that records state gonzo keeps in addition to the manifest.
+// The manifest is left untouched so that other nsm servers can still read it.
+const stateFilename = "gonzo.json"
+
+// SessionState is the state gonzo keeps for a session in addition to its manifest.
+type SessionState struct {
+	Clients map[string]ClientState `json:"clients"`
+}
+
+// ClientState is the state gonzo keeps for a client in addition to its manifest entry.
+type ClientState struct {
+	LaunchOptions
+
+	// GUIVisible is the last reported visibility of the client's optional GUI.
+	// It is nil if the client has never reported it.
+	GUIVisible *bool `json:"gui_visible,omitempty"`
+}
+
+// ReadSessionState reads session state from the provided io.Reader.
+func ReadSessionState(r io.Reader) (SessionState, error) {
+	state := SessionState{}
+	if err := json.NewDecoder(r).Decode(&state); err != nil {
+		return SessionState{}, errors.Wrap(err, "decoding session state")
+	}
+	if state.Clients == nil {
+		state.Clients = map[string]ClientState{}
+	}
+	return state, nil
+}
+
+// WriteTo writes the session state to an io.Writer.
+func (state SessionState) WriteTo(w io.Writer) (int64, error) {
+	buf, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return 0, errors.Wrap(err, "encoding session state")
+	}
+	n, err := w.Write(append(buf, '\n'))
+	return int64(n), err
+}
+
+// writeFileAtomic writes a file by writing to a temporary file which is then renamed,
+// so that the file on disk is never partially written.
+func writeFileAtomic(f string, wt io.WriterTo) error {
+	tmp := f + ".tmp"
+
+	fd, err := os.Create(tmp)
+	if err != nil {
+		return errors.Wrapf(err, "creating %s", tmp)
+	}
+	if _, err := wt.WriteTo(fd); err != nil {
+		_ = fd.Close() // Best effort.
+		return errors.Wrapf(err, "writing %s", tmp)
+	}
+	if err := fd.Close(); err != nil {
+		return errors.Wrapf(err, "closing %s", tmp)
+	}
+	return errors.Wrapf(os.Rename(tmp, f), "renaming %s", tmp)
+}
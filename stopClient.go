@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/scgolang/nsm"
+	"github.com/scgolang/osc"
+)
+
+// Addresses used to stop individual clients.
+const (
+	AddressClientKill = "/nsm/gui/client/kill"
+	AddressClientStop = "/nsm/gui/client/stop"
+)
+
+// KillClient kills a client in the current session.
+// The client stays in the session's manifest, so it is launched the next time the session is opened.
+func (app *App) KillClient(msg osc.Message) (string, nsm.Error) {
+	const code = nsm.ErrGeneral
+
+	if expected, got := 1, len(msg.Arguments); expected != got {
+		return "", nsm.NewError(code, fmt.Sprintf("expected %d arguments, got %d", expected, got))
+	}
+	clientID, err := msg.Arguments[0].ReadString()
+	if err != nil {
+		return "", nsm.NewError(code, "reading string from message")
+	}
+	currentSession, err := app.sessions.Current()
+	if err != nil {
+		return "", nsm.NewError(nsm.ErrNoSessionOpen, err.Error())
+	}
+	app.Debugf("killing client %s", clientID)
+
+	status, err := currentSession.Kill(clientID)
+	if err != nil {
+		return "", nsm.NewError(code, err.Error())
+	}
+	return "killed client " + clientID + ": " + status, nil
+}
+
+// KillClients kills all the clients in the current session.
+func (app *App) KillClients(msg osc.Message) (string, nsm.Error) {
+	currentSession, err := app.sessions.Current()
+	if err != nil {
+		return "", nsm.NewError(nsm.ErrNoSessionOpen, err.Error())
+	}
+	app.Debugf("killing all clients in session %s", currentSession.Name())
+
+	currentSession.KillAll()
+
+	return "killed all clients in session " + currentSession.Name(), nil
+}
+
+// StopClient stops a client in the current session.
+// The client is sent SIGTERM and killed if it has not exited after the grace period.
+// The client stays in the session's manifest, so it is launched the next time the session is opened.
+func (app *App) StopClient(msg osc.Message) (string, nsm.Error) {
+	const code = nsm.ErrGeneral
+
+	if expected, got := 1, len(msg.Arguments); expected != got {
+		return "", nsm.NewError(code, fmt.Sprintf("expected %d arguments, got %d", expected, got))
+	}
+	clientID, err := msg.Arguments[0].ReadString()
+	if err != nil {
+		return "", nsm.NewError(code, "reading string from message")
+	}
+	currentSession, err := app.sessions.Current()
+	if err != nil {
+		return "", nsm.NewError(nsm.ErrNoSessionOpen, err.Error())
+	}
+	app.Debugf("stopping client %s", clientID)
+
+	status, err := currentSession.Stop(clientID, app.GracePeriod)
+	if err != nil {
+		return "", nsm.NewError(code, err.Error())
+	}
+	return "stopped client " + clientID + ": " + status, nil
+}
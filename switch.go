@@ -0,0 +1,135 @@
+package main
+
+import (
+	"github.com/pkg/errors"
+	"github.com/scgolang/nsm"
+)
+
+// Switch moves running clients that have the switch capability to another session,
+// if the other session has a client that is not running and runs the same executable with the same arguments,
+// working directory and environment.
+// The moved clients keep running, but they must be told to open their project in the other session.
+// It returns the IDs in the other session of the clients that were moved.
+func (s *Session) Switch(to *Session) []string {
+	var (
+		from     = s.Manifest()
+		switched = []string{}
+		taken    = map[string]bool{}
+	)
+	for _, entry := range to.Manifest() {
+		if _, err := to.process(entry.ID); err == nil {
+			continue
+		}
+		clientID, ok := s.switchCandidate(from, entry, taken)
+		if !ok {
+			continue
+		}
+		if err := s.switchClient(clientID, to, entry.ID); err != nil {
+			s.dbg.Debugf("switching client %s to %s in session %s: %s", clientID, entry.ID, to.Name(), err)
+			continue
+		}
+		s.dbg.Debugf("switched client %s to %s in session %s", clientID, entry.ID, to.Name())
+		taken[clientID] = true
+		switched = append(switched, entry.ID)
+	}
+	return switched
+}
+
+// switchCandidate returns the ID of a running client that can be switched to the client described by a manifest entry.
+// A client with the same ID is preferred, which is the case when switching to a duplicate of the session.
+func (s *Session) switchCandidate(from Manifest, entry ManifestEntry, taken map[string]bool) (string, bool) {
+	candidates := []string{}
+	for _, e := range from {
+		if e.Executable != entry.Executable || !e.LaunchOptions.SameCommand(entry.LaunchOptions) || taken[e.ID] {
+			continue
+		}
+		client, err := s.Client(e.ID)
+		if err != nil || !client.HasCapability(nsm.CapClientSwitch) {
+			continue
+		}
+		if e.ID == entry.ID {
+			return e.ID, true
+		}
+		candidates = append(candidates, e.ID)
+	}
+	if len(candidates) == 0 {
+		return "", false
+	}
+	return candidates[0], true
+}
+
+// switchClient moves a running client to another session, where it has a new ID.
+// From now on the client's output is piped to its directory in the other session.
+func (s *Session) switchClient(clientID string, to *Session, newID string) error {
+	p, err := s.process(clientID)
+	if err != nil {
+		return err
+	}
+	// Hold the process's owner lock so that the process can not be
+	// removed from either session by exiting while it is being moved.
+	p.ownerMutex.Lock()
+	defer p.ownerMutex.Unlock()
+
+	stdoutFile, stderrFile, err := to.createLogFiles(newID)
+	if err != nil {
+		return err
+	}
+	client, err := s.release(clientID, p)
+	if err != nil {
+		_ = stdoutFile.Close() // Best effort.
+		_ = stderrFile.Close() // Best effort.
+		return errors.Wrap(err, "releasing client")
+	}
+	if err := p.stdoutLog.replace(stdoutFile); err != nil {
+		s.dbg.Debugf("closing stdout of client %s: %s", clientID, err)
+	}
+	if err := p.stderrLog.replace(stderrFile); err != nil {
+		s.dbg.Debugf("closing stderr of client %s: %s", clientID, err)
+	}
+	to.adopt(newID, p, client)
+	to.addLogFiles(newID, stdoutFile.Name(), stderrFile.Name())
+
+	p.session = to
+	p.clientID = newID
+
+	return nil
+}
+
+// release removes a running client from the session without stopping it.
+func (s *Session) release(clientID string, p *process) (*Client, error) {
+	s.clientsMutex.Lock()
+	client, ok := s.clients[clientID]
+	if !ok || client.Pid != Pid(p.Process.Pid) {
+		s.clientsMutex.Unlock()
+		return nil, errors.Errorf("client %s has not announced itself", clientID)
+	}
+	delete(s.clients, clientID)
+	s.clientsMutex.Unlock()
+
+	s.procsMutex.Lock()
+	delete(s.procs, clientID)
+	s.procsMutex.Unlock()
+
+	s.sessionClientsMutex.Lock()
+	delete(s.sessionClients, clientID)
+	s.sessionClientsMutex.Unlock()
+
+	return client, nil
+}
+
+// adopt adds a running client that was released by another session to the session.
+func (s *Session) adopt(clientID string, p *process, client *Client) {
+	client.ID = clientID
+
+	s.procsMutex.Lock()
+	s.procs[clientID] = p
+	s.procsMutex.Unlock()
+
+	s.clientsMutex.Lock()
+	s.clients[clientID] = client
+	s.clientsMutex.Unlock()
+
+	// The client has to be told to open its project in this session.
+	s.launched(clientID, p)
+	s.transition(clientID, client.Pid, StateAnnounced)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultTemplatesDirname is the name of the directory next to the sessions home directory
+// that contains session templates, unless another directory is configured.
+const DefaultTemplatesDirname = "gonzo-templates"
+
+// NewFromTemplate creates a new session from a template.
+// A template is a directory in the templates directory with the same layout as a session,
+// and the new session gets a copy of the template's manifest, state and client directories.
+// Every client in the new session is given a fresh ID, and paths in the launch options
+// that point into the template are rewritten to point into the new session.
+// Note that NewFromTemplate does not make the new session the current session.
+func (s *Sessions) NewFromTemplate(name, template string) error {
+	if err := s.checkNewFromTemplate(name, template); err != nil {
+		return err
+	}
+	var (
+		src = filepath.Join(s.Templates, template)
+		f   = filepath.Join(s.Home, name)
+	)
+	tmp, err := ioutil.TempDir(s.Home, ".template")
+	if err != nil {
+		return errors.Wrap(err, "creating temporary directory")
+	}
+	defer func() { _ = os.RemoveAll(tmp) }() // Best effort.
+
+	if err := copyTemplate(src, tmp, f); err != nil {
+		return errors.Wrapf(err, "copying template %s", template)
+	}
+	if err := os.Rename(tmp, f); err != nil {
+		return errors.Wrapf(err, "moving session to %s", f)
+	}
+	sesh, err := NewSession(s.ctx, s.dbg, s.sup, f)
+	if err != nil {
+		return errors.Wrapf(err, "could not open session %s", f)
+	}
+	if err := sesh.created(); err != nil {
+		return errors.Wrapf(err, "writing metadata for %s", f)
+	}
+	s.Mu.Lock()
+	s.M[f] = sesh
+	s.Mu.Unlock()
+
+	return nil
+}
+
+// checkNewFromTemplate returns an error if a new session with the provided name
+// can not be created from the provided template.
+func (s *Sessions) checkNewFromTemplate(name, template string) error {
+	if err := s.CheckNew(name); err != nil {
+		return err
+	}
+	if err := validateSessionName(template); err != nil {
+		return errors.Wrap(err, "invalid template name")
+	}
+	src := filepath.Join(s.Templates, template)
+
+	if fi, err := os.Stat(src); err != nil || !fi.IsDir() {
+		return errors.New("template " + src + " does not exist")
+	}
+	return nil
+}
+
+// copyTemplate copies the template in src to dst, giving every client a fresh ID.
+// Paths in the launch options are rewritten as if the session had been created at the path final.
+func copyTemplate(src, dst, final string) error {
+	m, err := readTemplateManifest(src)
+	if err != nil {
+		return err
+	}
+	state, err := readTemplateState(src)
+	if err != nil {
+		return err
+	}
+	var (
+		ids      = map[string]bool{}
+		dirs     = map[string]string{}
+		manifest = make(Manifest, len(m))
+		states   = map[string]ClientState{}
+		rewrites = [][2]string{}
+	)
+	for _, entry := range m {
+		ids[entry.ID] = true
+	}
+	for i, entry := range m {
+		clientID := NewClientID()
+		for ids[clientID] {
+			clientID = NewClientID()
+		}
+		ids[clientID] = true
+
+		next := ManifestEntry{Name: entry.Name, Executable: entry.Executable, ID: clientID}
+		dirs[clientDirname(entry)] = clientDirname(next)
+		rewrites = append(rewrites, [2]string{filepath.Join(src, clientDirname(entry)), filepath.Join(final, clientDirname(next))})
+
+		if cs, ok := state.Clients[entry.ID]; ok {
+			states[clientID] = cs
+		}
+		manifest[i] = next
+	}
+	// Client directories are rewritten before the template's directory, since they are inside of it.
+	rewrites = append(rewrites, [2]string{src, final})
+
+	state = SessionState{Clients: map[string]ClientState{}}
+	for clientID, cs := range states {
+		for _, rw := range rewrites {
+			cs.LaunchOptions = rewriteLaunchOptions(cs.LaunchOptions, rw[0], rw[1])
+		}
+		state.Clients[clientID] = cs
+	}
+	files, err := ioutil.ReadDir(src)
+	if err != nil {
+		return errors.Wrapf(err, "reading %s", src)
+	}
+	for _, fi := range files {
+		name := fi.Name()
+		if isMetaDir(name) || name == manifestFilename || name == stateFilename {
+			continue
+		}
+		target := filepath.Join(dst, name)
+		if to, ok := dirs[name]; ok {
+			target = filepath.Join(dst, to)
+		}
+		if err := copyTemplateFile(filepath.Join(src, name), target, fi); err != nil {
+			return err
+		}
+	}
+	if err := writeFileAtomic(filepath.Join(dst, manifestFilename), manifest); err != nil {
+		return errors.Wrap(err, "writing manifest")
+	}
+	return errors.Wrap(writeFileAtomic(filepath.Join(dst, stateFilename), state), "writing state")
+}
+
+// copyTemplateFile copies a file or directory at the top of a template.
+func copyTemplateFile(src, dst string, fi os.FileInfo) error {
+	switch mode := fi.Mode(); {
+	case mode.IsDir():
+		return errors.Wrapf(copyDir(src, dst), "copying %s", src)
+	case mode&os.ModeSymlink != 0:
+		link, err := os.Readlink(src)
+		if err != nil {
+			return errors.Wrapf(err, "reading link %s", src)
+		}
+		return errors.Wrapf(os.Symlink(link, dst), "creating link %s", dst)
+	case mode.IsRegular():
+		return errors.Wrapf(copyFile(src, dst, mode.Perm()), "copying %s", src)
+	}
+	// Skip sockets, pipes, devices, etc.
+	return nil
+}
+
+// readTemplateManifest reads the manifest of a template.
+// A template without a manifest has no clients.
+func readTemplateManifest(dir string) (Manifest, error) {
+	f := filepath.Join(dir, manifestFilename)
+	fd, err := os.Open(f)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Manifest{}, nil
+		}
+		return nil, errors.Wrapf(err, "opening %s", f)
+	}
+	defer func() { _ = fd.Close() }() // Best effort.
+
+	m, err := ReadManifest(fd)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading %s", f)
+	}
+	for _, entry := range m {
+		if err := entry.Validate(); err != nil {
+			return nil, errors.Wrapf(err, "validating client %s", entry.ID)
+		}
+	}
+	return m, nil
+}
+
+// readTemplateState reads the state of a template.
+// A template without a state file has no state.
+func readTemplateState(dir string) (SessionState, error) {
+	f := filepath.Join(dir, stateFilename)
+	fd, err := os.Open(f)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return SessionState{Clients: map[string]ClientState{}}, nil
+		}
+		return SessionState{}, errors.Wrapf(err, "opening %s", f)
+	}
+	defer func() { _ = fd.Close() }() // Best effort.
+
+	state, err := ReadSessionState(fd)
+	if err != nil {
+		return SessionState{}, errors.Wrapf(err, "reading %s", f)
+	}
+	return state, nil
+}
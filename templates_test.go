@@ -0,0 +1,126 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCopyTemplate(t *testing.T) {
+	var (
+		root  = t.TempDir()
+		src   = filepath.Join(root, DefaultTemplatesDirname, "band")
+		dst   = filepath.Join(root, "staging")
+		final = filepath.Join(root, "home", "gig")
+	)
+	manifest := Manifest{
+		{Name: "synth", Executable: "/usr/bin/synth", ID: "nAAAA"},
+		{Executable: "/usr/bin/drums", ID: "nBBBB"},
+	}
+	state := SessionState{Clients: map[string]ClientState{
+		"nAAAA": {LaunchOptions: LaunchOptions{
+			Dir:  filepath.Join(src, "synth.nAAAA"),
+			Args: []string{"-patch", filepath.Join(src, "synth.nAAAA", "patch.txt"), "-samples", filepath.Join(src, "samples")},
+			Env:  []string{"SYNTH_HOME=" + filepath.Join(src, "synth.nAAAA"), "TEMPLATE=" + src},
+		}},
+		"nBBBB": {LaunchOptions: LaunchOptions{
+			Args: []string{"-kit", filepath.Join(src, "drums.nBBBB", "kit.txt")},
+		}},
+	}}
+	writeTestFile(t, filepath.Join(src, "synth.nAAAA", "patch.txt"), "patch")
+	writeTestFile(t, filepath.Join(src, "drums.nBBBB", "kit.txt"), "kit")
+	writeTestFile(t, filepath.Join(src, "samples", "kick.wav"), "kick")
+	writeTestFile(t, filepath.Join(src, logsDirname, "nAAAA.stdout"), "output")
+	writeTestFile(t, filepath.Join(src, gitDirname, "HEAD"), "ref: refs/heads/master")
+
+	if err := writeFileAtomic(filepath.Join(src, manifestFilename), manifest); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(filepath.Join(src, stateFilename), state); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(dst, dirPerms); err != nil {
+		t.Fatal(err)
+	}
+	if err := copyTemplate(src, dst, final); err != nil {
+		t.Fatal(err)
+	}
+	copied, err := readTemplateManifest(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := len(manifest), len(copied); expected != got {
+		t.Fatalf("expected %d clients, got %d", expected, got)
+	}
+	copiedState, err := readTemplateState(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := map[string]bool{}
+
+	for i, entry := range copied {
+		if expected, got := manifest[i].Name, entry.Name; expected != got {
+			t.Fatalf("expected name %q, got %q", expected, got)
+		}
+		if expected, got := manifest[i].Executable, entry.Executable; expected != got {
+			t.Fatalf("expected executable %q, got %q", expected, got)
+		}
+		if !strings.HasPrefix(entry.ID, clientIDPrefix) {
+			t.Fatalf("expected client ID %q to start with %q", entry.ID, clientIDPrefix)
+		}
+		if entry.ID == "nAAAA" || entry.ID == "nBBBB" || ids[entry.ID] {
+			t.Fatalf("expected a fresh client ID, got %q", entry.ID)
+		}
+		ids[entry.ID] = true
+
+		// The client's directory is renamed after its new ID.
+		if _, err := os.Stat(filepath.Join(dst, clientDirname(manifest[i]))); !os.IsNotExist(err) {
+			t.Fatalf("expected %s to be renamed, got %v", clientDirname(manifest[i]), err)
+		}
+		if _, ok := copiedState.Clients[entry.ID]; !ok {
+			t.Fatalf("expected state for client %s", entry.ID)
+		}
+	}
+	var (
+		synth      = copied[0]
+		drums      = copied[1]
+		synthDir   = filepath.Join(final, clientDirname(synth))
+		synthState = copiedState.Clients[synth.ID].LaunchOptions
+		drumsState = copiedState.Clients[drums.ID].LaunchOptions
+	)
+	if expected, got := "patch", readTestFile(t, filepath.Join(dst, clientDirname(synth), "patch.txt")); expected != got {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+	if expected, got := "kit", readTestFile(t, filepath.Join(dst, clientDirname(drums), "kit.txt")); expected != got {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+	if expected, got := "kick", readTestFile(t, filepath.Join(dst, "samples", "kick.wav")); expected != got {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+	for _, testcase := range []struct {
+		expected string
+		got      string
+	}{
+		{synthDir, synthState.Dir},
+		{filepath.Join(synthDir, "patch.txt"), synthState.Args[1]},
+		{filepath.Join(final, "samples"), synthState.Args[3]},
+		{"SYNTH_HOME=" + synthDir, synthState.Env[0]},
+		{"TEMPLATE=" + final, synthState.Env[1]},
+		{filepath.Join(final, clientDirname(drums), "kit.txt"), drumsState.Args[1]},
+	} {
+		if testcase.expected != testcase.got {
+			t.Fatalf("expected %s, got %s", testcase.expected, testcase.got)
+		}
+	}
+	// The output and history of the template are not copied.
+	for _, name := range []string{logsDirname, gitDirname} {
+		if _, err := os.Stat(filepath.Join(dst, name)); !os.IsNotExist(err) {
+			t.Fatalf("expected %s to be left out of the copy, got %v", name, err)
+		}
+	}
+	// The template is left as it is.
+	if _, err := os.Stat(filepath.Join(src, "synth.nAAAA", "patch.txt")); err != nil {
+		t.Fatal(err)
+	}
+}